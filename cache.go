@@ -0,0 +1,396 @@
+package gore
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the maximum number of entries of a Cache without MaxEntries
+const DefaultCacheSize = 10000
+
+// cacheableCommands are the read-only commands whose reply can be cached
+var cacheableCommands = map[string]bool{
+	"GET":       true,
+	"GETRANGE":  true,
+	"STRLEN":    true,
+	"MGET":      true,
+	"EXISTS":    true,
+	"HGET":      true,
+	"HMGET":     true,
+	"HGETALL":   true,
+	"HEXISTS":   true,
+	"HLEN":      true,
+	"HKEYS":     true,
+	"HVALS":     true,
+	"LRANGE":    true,
+	"LINDEX":    true,
+	"LLEN":      true,
+	"SMEMBERS":  true,
+	"SISMEMBER": true,
+	"SCARD":     true,
+	"ZRANGE":    true,
+	"ZSCORE":    true,
+	"ZCARD":     true,
+}
+
+// invalidationChannel is the channel used by redis to send invalidation
+// messages to a redirect connection
+const invalidationChannel = "__redis__:invalidate"
+
+// Cache is a client side cache of replies, kept up to date by redis with CLIENT TRACKING.
+// Replies of read-only commands such as GET, HGET or HGETALL are cached, and
+// evicted when redis reports that one of their keys has been modified, when the
+// connection they were read from is disconnected, when they are older than TTL,
+// or when the cache is full.
+//
+// The cache opens a dedicated RESP2 connection subscribed to the invalidation channel,
+// and the other connections redirect their invalidation messages to it, so that they
+// are received even while the connections are idle. A Cache must only be used with
+// connections to the same redis server.
+type Cache struct {
+	// Maximum number of cached replies, DefaultCacheSize if not set
+	MaxEntries int
+	// Maximum time a reply is kept in the cache, forever if not set
+	TTL time.Duration
+
+	mutex      sync.Mutex
+	lru        *list.List
+	entries    map[string]*list.Element
+	keys       map[string]map[*list.Element]struct{}
+	generation uint64
+	address    string
+	listener   *Conn
+	redirect   int64
+	epoch      int
+	closed     bool
+}
+
+type cacheEntry struct {
+	key     string
+	keys    []string
+	reply   *Reply
+	expires time.Time
+}
+
+// NewCache returns a new cache
+func NewCache(maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		TTL:        ttl,
+	}
+}
+
+// Run returns the cached reply of the command if there is one, otherwise runs the
+// command on conn and caches its reply. Commands which cannot be cached are just run.
+func (c *Cache) Run(conn *Conn, cmd *Command) (*Reply, error) {
+	key, keys := cacheKey(cmd)
+	if key == "" {
+		return cmd.Run(conn)
+	}
+	c.mutex.Lock()
+	if rep := c.get(key); rep != nil {
+		c.mutex.Unlock()
+		return rep, nil
+	}
+	generation := c.generation
+	c.mutex.Unlock()
+	tracked := c.track(conn)
+	rep, err := cmd.Run(conn)
+	if err != nil || !tracked || rep.IsError() {
+		return rep, err
+	}
+	conn.Lock()
+	tracked = conn.cache == c
+	conn.Unlock()
+	c.mutex.Lock()
+	// An invalidation received while the command was running may be for
+	// this reply, which must not be cached then.
+	if tracked && generation == c.generation && !c.closed {
+		c.put(key, keys, rep)
+	}
+	c.mutex.Unlock()
+	return rep, nil
+}
+
+// RunPool runs the command like Run, with a connection acquired from pool
+func (c *Cache) RunPool(pool *Pool, cmd *Command) (rep *Reply, err error) {
+	err = pool.WithConn(func(conn *Conn) error {
+		rep, err = c.Run(conn, cmd)
+		return err
+	})
+	return rep, err
+}
+
+// Len returns the number of cached replies
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// Flush evicts every cached reply
+func (c *Cache) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.flush()
+}
+
+// Close flushes the cache and closes its invalidation connection, if any.
+// Commands run after Close are no longer cached.
+func (c *Cache) Close() {
+	c.mutex.Lock()
+	c.closed = true
+	c.flush()
+	listener := c.listener
+	c.mutex.Unlock()
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+// track makes sure CLIENT TRACKING is enabled on conn, and returns false
+// if replies read from conn cannot be cached.
+func (c *Cache) track(conn *Conn) bool {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return false
+	}
+	if c.address == "" {
+		c.address = conn.GetAddress()
+	}
+	if c.address != conn.GetAddress() {
+		c.mutex.Unlock()
+		return false
+	}
+	epoch := c.epoch
+	c.mutex.Unlock()
+	conn.Lock()
+	tracked := conn.cache == c && conn.cacheEpoch == epoch
+	conn.Unlock()
+	if tracked {
+		return true
+	}
+	redirect, err := c.listen(conn)
+	if err != nil || redirect == 0 {
+		return false
+	}
+	rep, err := NewCommand("CLIENT", "TRACKING", "ON", "REDIRECT", redirect).Run(conn)
+	if err != nil || !rep.IsOk() {
+		return false
+	}
+	conn.Lock()
+	conn.cache = c
+	conn.cacheEpoch = epoch
+	conn.Unlock()
+	return true
+}
+
+// listen opens the connection receiving invalidation messages, and returns
+// its client id, or 0 while it is reconnecting.
+func (c *Cache) listen(conn *Conn) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.listener != nil {
+		return c.redirect, nil
+	}
+	// Invalidation messages are published on a channel only with RESP2
+	options := Options{}
+	if conn.options != nil {
+		options = *conn.options
+	}
+	options.Protocol = 2
+	listener, err := DialWithOptions(conn.GetAddress(), &options)
+	if err != nil {
+		return 0, err
+	}
+	redirect, err := c.subscribe(listener)
+	if err != nil {
+		listener.Close()
+		return 0, err
+	}
+	c.listener = listener
+	c.redirect = redirect
+	go c.receive(listener)
+	return redirect, nil
+}
+
+// subscribe subscribes listener to the invalidation channel and returns its client id
+func (c *Cache) subscribe(listener *Conn) (int64, error) {
+	rep, err := NewCommand("CLIENT", "ID").Run(listener)
+	if err != nil {
+		return 0, err
+	}
+	redirect, err := rep.Int()
+	if err != nil {
+		return 0, err
+	}
+	if err = NewCommand("SUBSCRIBE", invalidationChannel).Send(listener); err != nil {
+		return 0, err
+	}
+	listener.Lock()
+	listener.subscribed = true
+	listener.tcpConn.SetReadDeadline(time.Time{})
+	listener.Unlock()
+	return redirect, nil
+}
+
+// receive reads invalidation messages from listener. When listener is
+// disconnected, the cache is flushed, and every connection enables tracking
+// again with the new client id once listener is reconnected.
+func (c *Cache) receive(listener *Conn) {
+	for {
+		rep, err := parseReply(listener)
+		if err == nil {
+			replies, _ := rep.Array()
+			if len(replies) == 3 && string(replies[0].stringValue) == "message" {
+				c.invalidate(replies[2])
+			}
+			continue
+		}
+		c.mutex.Lock()
+		c.flush()
+		c.redirect = 0
+		c.epoch++
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+		listener.fail(err)
+		for {
+			time.Sleep(listener.options.retryInterval())
+			if c.isClosed() {
+				return
+			}
+			if !listener.IsConnected() {
+				continue
+			}
+			redirect, err := c.subscribe(listener)
+			if err != nil {
+				continue
+			}
+			c.mutex.Lock()
+			c.redirect = redirect
+			c.mutex.Unlock()
+			break
+		}
+	}
+}
+
+func (c *Cache) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+// invalidate evicts the cached replies of an array of keys.
+// A nil reply means that every key is invalidated, after FLUSHALL for example.
+func (c *Cache) invalidate(keys *Reply) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	if keys.IsNil() {
+		c.flush()
+		return
+	}
+	for _, key := range keys.arrayValue {
+		for e := range c.keys[string(key.stringValue)] {
+			c.remove(e)
+		}
+	}
+}
+
+// get returns a cached reply, or nil. Caller must hold the lock.
+func (c *Cache) get(key string) *Reply {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(e)
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return entry.reply
+}
+
+// put caches a reply. Caller must hold the lock.
+func (c *Cache) put(key string, keys []string, rep *Reply) {
+	if c.lru == nil {
+		c.lru = list.New()
+		c.entries = make(map[string]*list.Element)
+		c.keys = make(map[string]map[*list.Element]struct{})
+	}
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	entry := &cacheEntry{
+		key:   key,
+		keys:  keys,
+		reply: rep,
+	}
+	if c.TTL > 0 {
+		entry.expires = time.Now().Add(c.TTL)
+	}
+	e := c.lru.PushFront(entry)
+	c.entries[key] = e
+	for _, k := range keys {
+		if c.keys[k] == nil {
+			c.keys[k] = make(map[*list.Element]struct{})
+		}
+		c.keys[k][e] = struct{}{}
+	}
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheSize
+	}
+	for c.lru.Len() > maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove evicts a cached reply. Caller must hold the lock.
+func (c *Cache) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	for _, k := range entry.keys {
+		delete(c.keys[k], e)
+		if len(c.keys[k]) == 0 {
+			delete(c.keys, k)
+		}
+	}
+}
+
+// flush evicts every cached reply. Caller must hold the lock.
+func (c *Cache) flush() {
+	c.generation++
+	c.lru = nil
+	c.entries = nil
+	c.keys = nil
+}
+
+// cacheKey returns the cache key of a command and the redis keys it reads,
+// or an empty key if the command cannot be cached.
+func cacheKey(cmd *Command) (string, []string) {
+	name := strings.ToUpper(cmd.name)
+	keys := cmd.Keys()
+	if !cacheableCommands[name] || len(keys) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	for _, arg := range cmd.args {
+		s := convertString(arg)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteString(":")
+		b.Write(s)
+	}
+	return b.String(), keys
+}
@@ -0,0 +1,172 @@
+package gore
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTrackingServer is a fake server storing string values, which sends
+// invalidation messages to the subscribed redirect connection when a value
+// is SET from any connection.
+type fakeTrackingServer struct {
+	*fakeServer
+	mutex      sync.Mutex
+	values     map[string]string
+	gets       int
+	subscriber net.Conn
+	tracking   []string
+}
+
+func newFakeTrackingServer(t *testing.T) *fakeTrackingServer {
+	s := &fakeTrackingServer{
+		values: make(map[string]string),
+	}
+	s.fakeServer = newFakeServer(t, nil)
+	s.fakeServer.connHandler = s.handle
+	return s
+}
+
+func (s *fakeTrackingServer) handle(c net.Conn, args []string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch args[0] {
+	case "HELLO":
+		return "%0\r\n"
+	case "GET":
+		s.gets++
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case "SET":
+		s.values[args[1]] = args[2]
+		keys := "*1\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+		if s.subscriber != nil {
+			s.subscriber.Write([]byte("*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n" + keys))
+		}
+		return "+OK\r\n"
+	case "CLIENT":
+		if args[1] == "ID" {
+			return ":42\r\n"
+		}
+		s.tracking = args
+		return "+OK\r\n"
+	case "SUBSCRIBE":
+		s.subscriber = c
+		return "*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n"
+	}
+	return "+OK\r\n"
+}
+
+func (s *fakeTrackingServer) getCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.gets
+}
+
+func TestCacheRESP3(t *testing.T) {
+	s := newFakeTrackingServer(t)
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{Protocol: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cache := NewCache(2, 0)
+	defer cache.Close()
+
+	NewCommand("SET", "touhou", "reimu").Run(conn)
+	for i := 0; i < 3; i++ {
+		rep, err := cache.Run(conn, NewCommand("GET", "touhou"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rep.String(); v != "reimu" {
+			t.Fatal(v)
+		}
+	}
+	if s.getCount() != 1 {
+		t.Fatal("reply was not cached", s.getCount())
+	}
+	if len(s.tracking) != 5 || s.tracking[3] != "REDIRECT" || s.tracking[4] != "42" {
+		t.Fatal(s.tracking)
+	}
+
+	// The key is modified from another connection, while conn is idle
+	other, err := Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	NewCommand("SET", "touhou", "marisa").Run(other)
+	waitInvalidation(t, cache)
+	rep, _ := cache.Run(conn, NewCommand("GET", "touhou"))
+	if v, _ := rep.String(); v != "marisa" || s.getCount() != 2 {
+		t.Fatal(v, s.getCount())
+	}
+
+	cache.Run(conn, NewCommand("GET", "alice"))
+	cache.Run(conn, NewCommand("GET", "patchouli"))
+	if cache.Len() != 2 {
+		t.Fatal("cache is not bounded", cache.Len())
+	}
+
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	if cache.Len() != 0 {
+		t.Fatal("cache was not flushed on disconnect")
+	}
+}
+
+func TestCacheRESP2(t *testing.T) {
+	s := newFakeTrackingServer(t)
+	defer s.Close()
+
+	conn, err := Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cache := &Cache{TTL: 50 * time.Millisecond}
+	defer cache.Close()
+
+	NewCommand("SET", "touhou", "reimu").Run(conn)
+	cache.Run(conn, NewCommand("GET", "touhou"))
+	cache.Run(conn, NewCommand("GET", "touhou"))
+	if s.getCount() != 1 {
+		t.Fatal("reply was not cached", s.getCount())
+	}
+	if len(s.tracking) != 5 || s.tracking[3] != "REDIRECT" || s.tracking[4] != "42" {
+		t.Fatal(s.tracking)
+	}
+
+	NewCommand("SET", "touhou", "marisa").Run(conn)
+	waitInvalidation(t, cache)
+	rep, _ := cache.Run(conn, NewCommand("GET", "touhou"))
+	if v, _ := rep.String(); v != "marisa" {
+		t.Fatal(v)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	cache.Run(conn, NewCommand("GET", "touhou"))
+	if s.getCount() != 3 {
+		t.Fatal("reply did not expire", s.getCount())
+	}
+}
+
+// waitInvalidation waits until the cache is emptied by an invalidation message
+func waitInvalidation(t *testing.T, cache *Cache) {
+	for i := 0; cache.Len() != 0; i++ {
+		if i == 100 {
+			t.Fatal("reply was not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,408 @@
+package gore
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClusterClient is a client of Redis Cluster. Unlike Cluster, which shards
+// keys itself over a fixed list of servers, ClusterClient learns which node
+// serves each hash slot from the cluster, with CLUSTER SLOTS or CLUSTER SHARDS,
+// and follows the MOVED and ASK redirects sent by the nodes while slots are
+// migrated. A Pool is kept for every node.
+type ClusterClient struct {
+	// Options used to open connections to every node
+	Options *Options
+	// RefreshInterval is the interval between refreshes of the slot map in
+	// background. The slot map is also refreshed after a MOVED redirect or a
+	// connection error.
+	RefreshInterval time.Duration
+	// MaxRedirects limits the number of redirects followed by one command
+	MaxRedirects int
+
+	seeds   []string
+	mutex   sync.RWMutex
+	slots   []string
+	nodes   map[string]*Pool
+	refresh chan struct{}
+	stop    chan struct{}
+	closed  bool
+}
+
+// slotRange is a range of hash slots served by a master node
+type slotRange struct {
+	start   int
+	end     int
+	address string
+}
+
+// NewClusterClient returns a new client of Redis Cluster, using options to
+// connect to every node. Seed nodes must be added before Dial.
+func NewClusterClient(options *Options) *ClusterClient {
+	return &ClusterClient{
+		Options: options,
+	}
+}
+
+// AddSeed adds addresses of cluster nodes used to discover the cluster.
+// Any node of the cluster can be a seed.
+func (c *ClusterClient) AddSeed(addresses ...string) {
+	c.seeds = append(c.seeds, addresses...)
+}
+
+// Dial discovers the cluster from the seed nodes, and starts refreshing
+// the slot map in background.
+func (c *ClusterClient) Dial() error {
+	if len(c.seeds) == 0 {
+		return ErrNoShard
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = seconds(Config.ClusterRefresh)
+	}
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = Config.ClusterMaxRedirects
+	}
+	c.nodes = make(map[string]*Pool)
+	c.refresh = make(chan struct{}, 1)
+	c.stop = make(chan struct{})
+	if err := c.Refresh(); err != nil {
+		c.Close()
+		return err
+	}
+	go c.refreshLoop()
+	return nil
+}
+
+// Close closes the connections to every node
+func (c *ClusterClient) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if c.stop != nil {
+		close(c.stop)
+	}
+	for _, pool := range c.nodes {
+		pool.Close()
+	}
+	c.nodes = make(map[string]*Pool)
+}
+
+// Execute runs a command on the node serving the slot of its keys. If the command
+// has no key (PING, INFO), this function returns ErrNoKey, and if its keys have
+// different slots, ErrCrossShard
+func (c *ClusterClient) Execute(cmd *Command) (*Reply, error) {
+	keys := cmd.Keys()
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	slot := Slot(keys[0])
+	for _, key := range keys[1:] {
+		if Slot(key) != slot {
+			return nil, ErrCrossShard
+		}
+	}
+	c.mutex.RLock()
+	address := ""
+	if c.slots != nil {
+		address = c.slots[slot]
+	}
+	c.mutex.RUnlock()
+	if address == "" {
+		c.triggerRefresh()
+		return nil, ErrNoShard
+	}
+	asking := false
+	for redirects := 0; ; redirects++ {
+		rep, err := c.run(address, cmd, asking)
+		if err != nil {
+			c.triggerRefresh()
+			return nil, err
+		}
+		redirect, target := redirection(rep, address)
+		switch redirect {
+		case "MOVED":
+			c.mutex.Lock()
+			if c.slots != nil {
+				c.slots[slot] = target
+			}
+			c.mutex.Unlock()
+			c.triggerRefresh()
+			asking = false
+		case "ASK":
+			asking = true
+		default:
+			return rep, nil
+		}
+		if redirects >= c.MaxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+		address = target
+	}
+}
+
+// Refresh reloads the slot map from the known nodes, or the seed nodes
+// if no known node answers.
+func (c *ClusterClient) Refresh() error {
+	c.mutex.RLock()
+	addresses := []string{}
+	known := make(map[string]bool)
+	for _, address := range c.slots {
+		if address != "" && !known[address] {
+			known[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	c.mutex.RUnlock()
+	for _, address := range c.seeds {
+		if !known[address] {
+			addresses = append(addresses, address)
+		}
+	}
+	err := ErrNoShard
+	for _, address := range addresses {
+		var ranges []slotRange
+		ranges, err = c.loadSlots(address)
+		if err == nil {
+			c.setSlots(ranges)
+			return nil
+		}
+	}
+	return err
+}
+
+// run runs the command on a node, after ASKING if asking is true
+func (c *ClusterClient) run(address string, cmd *Command, asking bool) (rep *Reply, err error) {
+	pool, err := c.node(address)
+	if err != nil {
+		return nil, err
+	}
+	err = pool.WithConn(func(conn *Conn) error {
+		if asking {
+			if _, err := NewCommand("ASKING").Run(conn); err != nil {
+				return err
+			}
+		}
+		rep, err = cmd.Run(conn)
+		return err
+	})
+	return rep, err
+}
+
+// node returns the pool of a node, and dials it if needed
+func (c *ClusterClient) node(address string) (*Pool, error) {
+	c.mutex.RLock()
+	pool, closed := c.nodes[address], c.closed
+	c.mutex.RUnlock()
+	if pool != nil {
+		return pool, nil
+	}
+	if closed {
+		return nil, ErrNotConnected
+	}
+	pool = &Pool{Options: c.Options}
+	if err := pool.Dial(address); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if existing := c.nodes[address]; existing != nil || c.closed {
+		pool.Close()
+		if existing == nil {
+			return nil, ErrNotConnected
+		}
+		return existing, nil
+	}
+	c.nodes[address] = pool
+	return pool, nil
+}
+
+// loadSlots asks a node for the slot map, with CLUSTER SLOTS, or CLUSTER
+// SHARDS if CLUSTER SLOTS is not available.
+func (c *ClusterClient) loadSlots(address string) ([]slotRange, error) {
+	pool, err := c.node(address)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(address)
+	rep, err := pool.Do(NewCommand("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	if !rep.IsError() {
+		return parseClusterSlots(rep, host)
+	}
+	rep, err = pool.Do(NewCommand("CLUSTER", "SHARDS"))
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterShards(rep, host)
+}
+
+// setSlots installs a new slot map, and closes the pools of nodes which
+// no longer serve any slot.
+func (c *ClusterClient) setSlots(ranges []slotRange) {
+	slots := make([]string, SlotCount)
+	used := make(map[string]bool)
+	for _, r := range ranges {
+		for slot := r.start; slot <= r.end && slot < SlotCount; slot++ {
+			slots[slot] = r.address
+		}
+		used[r.address] = true
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.slots = slots
+	for address, pool := range c.nodes {
+		if !used[address] {
+			pool.Close()
+			delete(c.nodes, address)
+		}
+	}
+}
+
+func (c *ClusterClient) triggerRefresh() {
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *ClusterClient) refreshLoop() {
+	ticker := time.NewTicker(c.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.refresh:
+		}
+		c.Refresh()
+	}
+}
+
+// redirection returns the kind of redirect of an error reply, MOVED or ASK,
+// and the address of the target node, or an empty kind if the reply is not
+// a redirect. address is the node which sent the reply.
+func redirection(rep *Reply, address string) (string, string) {
+	if !rep.IsError() {
+		return "", ""
+	}
+	message, _ := rep.Error()
+	pieces := strings.Fields(message)
+	if len(pieces) != 3 || (pieces[0] != "MOVED" && pieces[0] != "ASK") {
+		return "", ""
+	}
+	target := pieces[2]
+	if strings.HasPrefix(target, ":") {
+		// The target node has the same host as the node which sent the reply
+		host, _, _ := net.SplitHostPort(address)
+		target = net.JoinHostPort(host, target[1:])
+	}
+	return pieces[0], target
+}
+
+// parseClusterSlots parses the reply of CLUSTER SLOTS. host is used for nodes
+// without a known address.
+func parseClusterSlots(rep *Reply, host string) ([]slotRange, error) {
+	entries, err := rep.Array()
+	if err != nil {
+		return nil, err
+	}
+	ranges := []slotRange{}
+	for _, entry := range entries {
+		fields, err := entry.Array()
+		if err != nil || len(fields) < 3 {
+			return nil, ErrType
+		}
+		start, err := fields[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		end, err := fields[1].Int()
+		if err != nil {
+			return nil, err
+		}
+		master, err := fields[2].Array()
+		if err != nil || len(master) < 2 {
+			return nil, ErrType
+		}
+		ip, _ := master[0].String()
+		port, err := master[1].Int()
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, slotRange{int(start), int(end), nodeAddress(ip, host, port)})
+	}
+	return ranges, nil
+}
+
+// parseClusterShards parses the reply of CLUSTER SHARDS. host is used for nodes
+// without a known address.
+func parseClusterShards(rep *Reply, host string) ([]slotRange, error) {
+	shards, err := rep.Array()
+	if err != nil {
+		return nil, err
+	}
+	ranges := []slotRange{}
+	for _, shard := range shards {
+		fields, err := shard.MapValue()
+		if err != nil || fields["slots"] == nil || fields["nodes"] == nil {
+			return nil, ErrType
+		}
+		slots := []int{}
+		if err = fields["slots"].Slice(&slots); err != nil || len(slots)%2 != 0 {
+			return nil, ErrType
+		}
+		nodes, err := fields["nodes"].Array()
+		if err != nil {
+			return nil, err
+		}
+		address := ""
+		for _, node := range nodes {
+			info, err := node.MapValue()
+			if err != nil {
+				return nil, err
+			}
+			if role := info["role"]; role == nil || string(role.stringValue) != "master" {
+				continue
+			}
+			if info["port"] == nil {
+				return nil, ErrType
+			}
+			port, err := info["port"].Int()
+			if err != nil {
+				return nil, err
+			}
+			ip := ""
+			if info["endpoint"] != nil {
+				ip, _ = info["endpoint"].String()
+			} else if info["ip"] != nil {
+				ip, _ = info["ip"].String()
+			}
+			address = nodeAddress(ip, host, port)
+		}
+		if address == "" {
+			continue
+		}
+		for i := 0; i < len(slots); i += 2 {
+			ranges = append(ranges, slotRange{slots[i], slots[i+1], address})
+		}
+	}
+	return ranges, nil
+}
+
+// nodeAddress returns the address of a node. An empty or unknown ip means the
+// node has the same host as the node which sent the slot map.
+func nodeAddress(ip, host string, port int64) string {
+	if ip == "" || ip == "?" {
+		ip = host
+	}
+	return net.JoinHostPort(ip, strconv.FormatInt(port, 10))
+}
@@ -0,0 +1,232 @@
+package gore
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeCluster is a stand-in for a Redis Cluster of several nodes, storing
+// string values. Each slot is owned by one node, and may be migrating to
+// another node.
+type fakeCluster struct {
+	t         *testing.T
+	mutex     sync.Mutex
+	nodes     []*fakeServer
+	owners    [SlotCount]int
+	migrating map[int]int
+	values    []map[string]string
+	asking    map[net.Conn]bool
+	commands  []int
+	shards    bool
+}
+
+func newFakeCluster(t *testing.T, size int) *fakeCluster {
+	c := &fakeCluster{
+		t:         t,
+		migrating: make(map[int]int),
+		asking:    make(map[net.Conn]bool),
+		commands:  make([]int, size),
+	}
+	for i := 0; i < size; i++ {
+		i := i
+		node := newFakeServer(t, nil)
+		node.connHandler = func(conn net.Conn, args []string) string {
+			return c.handle(i, conn, args)
+		}
+		c.nodes = append(c.nodes, node)
+		c.values = append(c.values, make(map[string]string))
+	}
+	for slot := range c.owners {
+		c.owners[slot] = slot * size / SlotCount
+	}
+	return c
+}
+
+func (c *fakeCluster) Close() {
+	for _, node := range c.nodes {
+		node.Close()
+	}
+}
+
+func (c *fakeCluster) handle(i int, conn net.Conn, args []string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	asking := c.asking[conn]
+	delete(c.asking, conn)
+	switch args[0] {
+	case "CLUSTER":
+		if args[1] == "SLOTS" && !c.shards {
+			return c.slots()
+		} else if args[1] == "SHARDS" && c.shards {
+			return c.shardsReply()
+		}
+		return "-ERR unknown subcommand\r\n"
+	case "ASKING":
+		c.asking[conn] = true
+		return "+OK\r\n"
+	case "GET", "SET":
+		c.commands[i]++
+		slot := Slot(args[1])
+		_, here := c.values[i][args[1]]
+		if owner := c.owners[slot]; owner != i {
+			if target, ok := c.migrating[slot]; !ok || target != i || !asking {
+				return "-MOVED " + strconv.Itoa(slot) + " " + c.nodes[owner].Addr() + "\r\n"
+			}
+		} else if target, ok := c.migrating[slot]; ok && !here {
+			return "-ASK " + strconv.Itoa(slot) + " " + c.nodes[target].Addr() + "\r\n"
+		}
+		if args[0] == "SET" {
+			c.values[i][args[1]] = args[2]
+			return "+OK\r\n"
+		}
+		if !here {
+			return "$-1\r\n"
+		}
+		v := c.values[i][args[1]]
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// ranges returns the slot ranges of each node as start, end and node
+func (c *fakeCluster) ranges() [][3]int {
+	ranges := [][3]int{}
+	start := 0
+	for slot := 1; slot <= SlotCount; slot++ {
+		if slot == SlotCount || c.owners[slot] != c.owners[start] {
+			ranges = append(ranges, [3]int{start, slot - 1, c.owners[start]})
+			start = slot
+		}
+	}
+	return ranges
+}
+
+func (c *fakeCluster) slots() string {
+	ranges := c.ranges()
+	rep := "*" + strconv.Itoa(len(ranges)) + "\r\n"
+	for _, r := range ranges {
+		_, port, _ := net.SplitHostPort(c.nodes[r[2]].Addr())
+		rep += "*3\r\n:" + strconv.Itoa(r[0]) + "\r\n:" + strconv.Itoa(r[1]) + "\r\n" +
+			"*2\r\n$9\r\n127.0.0.1\r\n:" + port + "\r\n"
+	}
+	return rep
+}
+
+func (c *fakeCluster) shardsReply() string {
+	ranges := c.ranges()
+	rep := "*" + strconv.Itoa(len(ranges)) + "\r\n"
+	for _, r := range ranges {
+		_, port, _ := net.SplitHostPort(c.nodes[r[2]].Addr())
+		rep += "*4\r\n$5\r\nslots\r\n*2\r\n:" + strconv.Itoa(r[0]) + "\r\n:" + strconv.Itoa(r[1]) + "\r\n" +
+			"$5\r\nnodes\r\n*1\r\n*6\r\n$4\r\nport\r\n:" + port + "\r\n$8\r\nendpoint\r\n$9\r\n127.0.0.1\r\n$4\r\nrole\r\n$6\r\nmaster\r\n"
+	}
+	return rep
+}
+
+func TestSlot(t *testing.T) {
+	if slot := Slot("foo"); slot != 12182 {
+		t.Fatal(slot)
+	}
+	if slot := Slot("123456789"); slot != 0x31C3 {
+		t.Fatal(slot)
+	}
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") || Slot("{user1000}.following") != Slot("user1000") {
+		t.Fatal("hash tags are not used")
+	}
+	if Slot("foo{}{bar}") != Slot("foo{}{bar}") || Slot("foo{}{bar}") == Slot("bar") {
+		t.Fatal("empty hash tags must be ignored")
+	}
+}
+
+func TestClusterClient(t *testing.T) {
+	fake := newFakeCluster(t, 3)
+	defer fake.Close()
+
+	c := NewClusterClient(&Options{PoolInitialSize: 1})
+	c.AddSeed(fake.nodes[1].Addr())
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 30; i++ {
+		key := "key" + strconv.Itoa(i)
+		if rep, err := c.Execute(NewCommand("SET", key, i)); err != nil || !rep.IsOk() {
+			t.Fatal(rep, err)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		rep, err := c.Execute(NewCommand("GET", "key"+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rep.Int(); v != int64(i) {
+			t.Fatal(i, v)
+		}
+	}
+	if _, err := c.Execute(NewCommand("RENAME", "{user1000}.a", "{user1001}.a")); err != ErrCrossShard {
+		t.Fatal("expected ErrCrossShard", err)
+	}
+	for i, count := range fake.commands {
+		if count == 0 {
+			t.Fatal("node was not used", i)
+		}
+	}
+
+	// Move the slot of "foo" to another node
+	fake.mutex.Lock()
+	slot := Slot("foo")
+	from := fake.owners[slot]
+	to := (from + 1) % 3
+	fake.owners[slot] = to
+	fake.mutex.Unlock()
+	if rep, err := c.Execute(NewCommand("SET", "foo", "bar")); err != nil || !rep.IsOk() {
+		t.Fatal(rep, err)
+	}
+	if fake.values[to]["foo"] != "bar" {
+		t.Fatal("MOVED was not followed")
+	}
+	fake.mutex.Lock()
+	before := fake.commands[from]
+	fake.mutex.Unlock()
+	c.Execute(NewCommand("GET", "foo"))
+	fake.mutex.Lock()
+	if fake.commands[from] != before {
+		t.Fatal("slot map was not updated")
+	}
+
+	// Migrate the slot of "foo" back, with "foo" not moved yet
+	fake.migrating[slot] = from
+	delete(fake.values[to], "foo")
+	fake.mutex.Unlock()
+	if rep, err := c.Execute(NewCommand("SET", "foo", "baz")); err != nil || !rep.IsOk() {
+		t.Fatal(rep, err)
+	}
+	fake.mutex.Lock()
+	if fake.values[from]["foo"] != "baz" {
+		t.Fatal("ASK was not followed")
+	}
+	fake.mutex.Unlock()
+}
+
+func TestClusterClientShards(t *testing.T) {
+	fake := newFakeCluster(t, 2)
+	fake.shards = true
+	defer fake.Close()
+
+	c := NewClusterClient(&Options{PoolInitialSize: 1})
+	c.AddSeed(fake.nodes[0].Addr())
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if rep, err := c.Execute(NewCommand("SET", "foo", "bar")); err != nil || !rep.IsOk() {
+		t.Fatal(rep, err)
+	}
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if fake.commands[fake.owners[Slot("foo")]] != 1 {
+		t.Fatal("command was not sent to the owner of the slot", fake.commands)
+	}
+}
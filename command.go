@@ -1,6 +1,7 @@
 package gore
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -9,8 +10,9 @@ import (
 
 // Command sent to redis
 type Command struct {
-	name string
-	args []interface{}
+	name    string
+	args    []interface{}
+	timeout time.Duration
 }
 
 // NewCommand returns a new Command
@@ -21,8 +23,28 @@ func NewCommand(name string, args ...interface{}) *Command {
 	}
 }
 
+// SetTimeout overrides the read timeout of the connection for this command.
+// A negative timeout means no timeout. Without an override, the read timeout
+// of blocking commands such as BLPOP, XREAD BLOCK or WAIT is extended by their
+// own block time.
+func (cmd *Command) SetTimeout(timeout time.Duration) *Command {
+	cmd.timeout = timeout
+	return cmd
+}
+
 // Run sends command to redis
 func (cmd *Command) Run(conn *Conn) (r *Reply, err error) {
+	return cmd.RunContext(context.Background(), conn)
+}
+
+// RunContext sends command to redis. The command is aborted when ctx is
+// cancelled, and ctx deadline is used instead of the connection timeouts if it
+// is sooner. When the command is aborted after being written, the reply can
+// no longer be matched, so the connection is marked as failed and reconnected.
+func (cmd *Command) RunContext(ctx context.Context, conn *Conn) (r *Reply, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	conn.Lock()
 	if conn.state != connStateConnected {
 		conn.Unlock()
@@ -32,55 +54,150 @@ func (cmd *Command) Run(conn *Conn) (r *Reply, err error) {
 		if err != nil {
 			conn.state = connStateNotConnected
 			conn.Unlock()
-			conn.fail()
+			conn.fail(err)
 		} else {
 			conn.Unlock()
 		}
 	}()
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetWriteDeadline(time.Now().Add(conn.RequestTimeout))
-	}
+	stop := conn.watchContext(ctx)
+	defer stop()
+	conn.tcpConn.SetWriteDeadline(deadline(ctx, conn.writeTimeout()))
 	err = cmd.writeCommand(conn)
 	if err != nil {
-		return nil, ErrWrite
+		return nil, contextError(ctx, ErrWrite)
 	}
 	err = conn.wb.Flush()
 	if err != nil {
-		return nil, ErrWrite
+		return nil, contextError(ctx, ErrWrite)
+	}
+	conn.tcpConn.SetReadDeadline(deadline(ctx, cmd.readTimeout(conn.readTimeout())))
+	if err = ctx.Err(); err != nil {
+		return nil, err
 	}
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetReadDeadline(time.Now().Add(conn.RequestTimeout))
+	r, err = readReply(conn)
+	if err != nil {
+		return nil, contextError(ctx, err)
 	}
-	return readReply(conn)
+	conn.trackUnsubscribe(r)
+	return r, nil
 }
 
 // Send safely sends a command over conn
 func (cmd *Command) Send(conn *Conn) (err error) {
+	return cmd.SendContext(context.Background(), conn)
+}
+
+// SendContext safely sends a command over conn. The write is aborted
+// when ctx is cancelled.
+func (cmd *Command) SendContext(ctx context.Context, conn *Conn) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	conn.Lock()
 	defer func() {
 		if err != nil {
 			conn.state = connStateNotConnected
 			conn.Unlock()
-			conn.fail()
+			conn.fail(err)
 		} else {
 			conn.Unlock()
 		}
 	}()
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetWriteDeadline(time.Now().Add(conn.RequestTimeout))
-	}
+	stop := conn.watchContext(ctx)
+	defer stop()
+	conn.tcpConn.SetWriteDeadline(deadline(ctx, conn.writeTimeout()))
 	err = cmd.writeCommand(conn)
 	if err != nil {
-		return ErrWrite
+		return contextError(ctx, ErrWrite)
 	}
 	err = conn.wb.Flush()
 	if err != nil {
-		return ErrWrite
+		return contextError(ctx, ErrWrite)
 	}
 	return nil
 }
 
+// readTimeout returns the time to wait for the reply of the command, when
+// the connection read timeout is timeout. A negative value means no timeout.
+func (cmd *Command) readTimeout(timeout time.Duration) time.Duration {
+	if cmd.timeout != 0 {
+		return cmd.timeout
+	}
+	if timeout <= 0 {
+		return -1
+	}
+	if block, ok := cmd.blockTime(); ok {
+		if block == 0 {
+			// Blocks forever
+			return -1
+		}
+		return timeout + block
+	}
+	return timeout
+}
+
+// blockTime returns how long a blocking command may wait on the server.
+// Zero means the command may block forever.
+func (cmd *Command) blockTime() (time.Duration, bool) {
+	name := strings.ToUpper(cmd.name)
+	switch name {
+	case "BLPOP", "BRPOP", "BRPOPLPUSH", "BLMOVE", "BZPOPMIN", "BZPOPMAX":
+		if len(cmd.args) == 0 {
+			return 0, false
+		}
+		return parseBlockTime(cmd.args[len(cmd.args)-1], time.Second)
+	case "BLMPOP", "BZMPOP":
+		if len(cmd.args) == 0 {
+			return 0, false
+		}
+		return parseBlockTime(cmd.args[0], time.Second)
+	case "WAIT", "WAITAOF":
+		if len(cmd.args) == 0 {
+			return 0, false
+		}
+		return parseBlockTime(cmd.args[len(cmd.args)-1], time.Millisecond)
+	case "XREAD", "XREADGROUP":
+		for i := 0; i < len(cmd.args)-1; i++ {
+			option := strings.ToUpper(string(convertString(cmd.args[i])))
+			if option == "STREAMS" {
+				break
+			}
+			if option == "BLOCK" {
+				return parseBlockTime(cmd.args[i+1], time.Millisecond)
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseBlockTime(arg interface{}, unit time.Duration) (time.Duration, bool) {
+	x, err := strconv.ParseFloat(string(convertString(arg)), 64)
+	if err != nil || x < 0 {
+		return 0, false
+	}
+	return time.Duration(x * float64(unit)), true
+}
+
+// readTimeout returns the time to wait for the replies of cmds. The connection
+// read timeout is scaled with the number of commands, and extended to the
+// longest command read timeout. A negative value means no timeout.
+func readTimeout(conn *Conn, cmds []*Command) time.Duration {
+	timeout := conn.readTimeout() * time.Duration(len(cmds)/10+1)
+	for _, cmd := range cmds {
+		t := cmd.readTimeout(conn.readTimeout())
+		if t < 0 {
+			return -1
+		}
+		if t > timeout {
+			timeout = t
+		}
+	}
+	return timeout
+}
+
 func (cmd *Command) writeCommand(conn *Conn) error {
+	conn.lastUsed = time.Now()
+	conn.trackSession(cmd)
 	cmdLen := strconv.FormatInt(int64(len(cmd.args))+1, 10)
 	_, err := conn.wb.WriteString("*" + cmdLen + "\r\n")
 	if err != nil {
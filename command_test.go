@@ -3,6 +3,7 @@ package gore
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 var (
@@ -245,3 +246,54 @@ func TestCommandGoroutine(t *testing.T) {
 		t.Fatal(err, "not ok")
 	}
 }
+
+func TestCommandReadTimeout(t *testing.T) {
+	timeout := time.Second
+	tests := []struct {
+		cmd      *Command
+		expected time.Duration
+	}{
+		{NewCommand("GET", "key"), time.Second},
+		{NewCommand("BLPOP", "a", "b", 30), 31 * time.Second},
+		{NewCommand("brpop", "a", 0.5), 1500 * time.Millisecond},
+		{NewCommand("BLPOP", "a", 0), -1},
+		{NewCommand("BZMPOP", 2, 1, "a", "MIN"), 3 * time.Second},
+		{NewCommand("XREAD", "COUNT", 2, "BLOCK", 500, "STREAMS", "a", "$"), 1500 * time.Millisecond},
+		{NewCommand("XREAD", "STREAMS", "BLOCK", "0"), time.Second},
+		{NewCommand("WAIT", 1, 100), 1100 * time.Millisecond},
+		{NewCommand("BLPOP", "a", 30).SetTimeout(time.Minute), time.Minute},
+		{NewCommand("GET", "a").SetTimeout(-1), -1},
+	}
+	for _, test := range tests {
+		if d := test.cmd.readTimeout(timeout); d != test.expected {
+			t.Fatal(test.cmd.name, test.cmd.args, d, test.expected)
+		}
+	}
+	if d := NewCommand("GET", "key").readTimeout(0); d != -1 {
+		t.Fatal(d)
+	}
+}
+
+func TestReadWriteTimeout(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		time.Sleep(200 * time.Millisecond)
+		return "*2\r\n$1\r\na\r\n$1\r\nb\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{ReadTimeout: 100 * time.Millisecond, WriteTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.readTimeout() != 100*time.Millisecond || conn.writeTimeout() != time.Second {
+		t.Fatal(conn.readTimeout(), conn.writeTimeout())
+	}
+	rep, err := NewCommand("BLPOP", "a", 1).Run(conn)
+	if err != nil || !rep.IsArray() {
+		t.Fatal(err, rep)
+	}
+	if _, err = NewCommand("LRANGE", "a", 0, -1).Run(conn); err != ErrRead {
+		t.Fatal(err)
+	}
+}
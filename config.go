@@ -1,16 +1,25 @@
 package gore
 
-// Config keeps some default configurations. Time is measured in second
+// Config keeps some default configurations. Time is measured in second.
+// These values are only used when the matching Options field is not set.
 var Config = &struct {
-	ConnectTimeout  int
-	RequestTimeout  int
-	ReconnectTime   int
-	PoolInitialSize int
-	PoolMaximumSize int
+	ConnectTimeout       int
+	RequestTimeout       int
+	ReconnectTime        int
+	MaximumReconnectTime int
+	RetryInterval        int
+	PoolInitialSize      int
+	PoolMaximumSize      int
+	ClusterRefresh       int
+	ClusterMaxRedirects  int
 }{
-	ConnectTimeout:  5,
-	RequestTimeout:  10,
-	ReconnectTime:   2,
-	PoolInitialSize: 5,
-	PoolMaximumSize: 10,
+	ConnectTimeout:       5,
+	RequestTimeout:       10,
+	ReconnectTime:        2,
+	MaximumReconnectTime: 30,
+	RetryInterval:        2,
+	PoolInitialSize:      5,
+	PoolMaximumSize:      10,
+	ClusterRefresh:       30,
+	ClusterMaxRedirects:  5,
 }
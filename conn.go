@@ -2,7 +2,10 @@ package gore
 
 import (
 	"bufio"
+	"context"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,6 +16,10 @@ const (
 	connStateReconnecting
 )
 
+// minCheckInterval is the shortest period of the background checks, because
+// a ticker cannot have a zero period
+const minCheckInterval = time.Millisecond
+
 // Conn holds a persistent connection to a redis server
 type Conn struct {
 	address        string
@@ -23,39 +30,113 @@ type Conn struct {
 	wb             *bufio.Writer
 	sentinel       bool
 	RequestTimeout time.Duration
-	isClosed       bool
-	password       string
+	// ReadTimeout and WriteTimeout limit reading a reply and writing a
+	// command separately. Zero means RequestTimeout is used.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	isClosed     bool
+	username     string
+	password     string
+	database     int
+	clientName   string
+	options      *Options
+	pushHandler  func(*Reply)
+	futures      futureQueue
+	cache        *Cache
+	cacheEpoch   int
+	lastUsed     time.Time
+	watching     bool
+	inMulti      bool
+	connectedAt  time.Time
+	idleSince    time.Time
+	subscribed   bool
+	// reconnected is closed when the current reconnection succeeds or is given up
+	reconnected chan struct{}
+	// readMutex is held while the replies of futures are read, and while the
+	// connection is opened, so that they are never read from a half opened connection
+	readMutex sync.Mutex
 }
 
 // Dial opens a TCP connection with a redis server.
 func Dial(address string) (*Conn, error) {
-	conn := &Conn{
-		RequestTimeout: time.Duration(Config.RequestTimeout) * time.Second,
-	}
-	conn.mutex.Lock()
-	defer conn.mutex.Unlock()
-	err := conn.connect(address, 0)
-	return conn, err
+	return dialContext(context.Background(), address, 0, nil)
 }
 
 // DialTimeout opens a TCP connection with a redis server with a connection timeout
 func DialTimeout(address string, timeout time.Duration) (*Conn, error) {
+	return dialContext(context.Background(), address, timeout, nil)
+}
+
+// DialContext opens a TCP connection with a redis server. The context
+// can cancel or put a deadline on the dialing.
+func DialContext(ctx context.Context, address string) (*Conn, error) {
+	return dialContext(ctx, address, 0, nil)
+}
+
+// DialWithOptions opens a connection with a redis server using options.
+// The options are kept and used again when the connection is reconnected.
+func DialWithOptions(address string, options *Options) (*Conn, error) {
+	return dialContext(context.Background(), address, 0, options)
+}
+
+func dialContext(ctx context.Context, address string, timeout time.Duration, options *Options) (*Conn, error) {
+	conn := newConn(options)
+	err := conn.dial(ctx, address, timeout)
+	return conn, err
+}
+
+func newConn(options *Options) *Conn {
 	conn := &Conn{
-		RequestTimeout: time.Duration(Config.RequestTimeout) * time.Second,
+		RequestTimeout: options.requestTimeout(),
+		options:        options,
 	}
-	conn.mutex.Lock()
-	defer conn.mutex.Unlock()
-	err := conn.connect(address, timeout)
-	return conn, err
+	if options != nil {
+		conn.ReadTimeout = options.ReadTimeout
+		conn.WriteTimeout = options.WriteTimeout
+		conn.username = options.Username
+		conn.password = options.Password
+		conn.database = options.Database
+		conn.clientName = options.ClientName
+		conn.pushHandler = options.PushHandler
+	}
+	return conn
+}
+
+func (c *Conn) dial(ctx context.Context, address string, timeout time.Duration) error {
+	c.mutex.Lock()
+	err := c.connect(ctx, address, timeout)
+	c.mutex.Unlock()
+	if err == nil {
+		c.options.emit(&Event{Type: EventConnected, Address: address})
+		if interval := c.options.healthCheckInterval(); interval > 0 {
+			go c.healthCheck(interval)
+		}
+	} else if err == ErrAuth {
+		c.options.emit(&Event{Type: EventAuthFailed, Address: address, Err: err})
+	}
+	return err
 }
 
 // Auth makes authentication with redis server
 func (c *Conn) Auth(password string) error {
+	return c.AuthWithUsername("", password)
+}
+
+// AuthWithUsername makes authentication with redis server as a Redis 6 ACL user.
+// The credentials are sent again every time the connection is reconnected.
+func (c *Conn) AuthWithUsername(username, password string) error {
+	c.mutex.Lock()
+	c.username = username
 	c.password = password
-	if c.password == "" {
+	c.mutex.Unlock()
+	if password == "" {
 		return nil
 	}
-	rep, err := NewCommand("AUTH", password).Run(c)
+	args := []interface{}{password}
+	if username != "" {
+		args = []interface{}{username, password}
+	}
+	rep, err := NewCommand("AUTH", args...).Run(c)
 	if err != nil {
 		return err
 	}
@@ -65,6 +146,56 @@ func (c *Conn) Auth(password string) error {
 	return nil
 }
 
+// Select changes the database of the connection. The database is selected
+// again every time the connection is reconnected.
+func (c *Conn) Select(database int) error {
+	c.mutex.Lock()
+	previous := c.database
+	c.mutex.Unlock()
+	rep, err := NewCommand("SELECT", database).Run(c)
+	if err != nil {
+		return err
+	}
+	if !rep.IsOk() {
+		// The database was recorded when SELECT was sent
+		c.mutex.Lock()
+		c.database = previous
+		c.mutex.Unlock()
+		return ErrSelect
+	}
+	return nil
+}
+
+// SetName sets the connection name with CLIENT SETNAME. The name is set
+// again every time the connection is reconnected.
+func (c *Conn) SetName(name string) error {
+	rep, err := NewCommand("CLIENT", "SETNAME", name).Run(c)
+	if err != nil {
+		return err
+	}
+	if !rep.IsOk() {
+		return ErrClientName
+	}
+	c.mutex.Lock()
+	c.clientName = name
+	c.mutex.Unlock()
+	return nil
+}
+
+// Ping sends PING to redis server and waits for the reply within the read
+// timeout of the connection. If the server does not answer in time, the
+// connection is marked as failed and reconnected.
+func (c *Conn) Ping() error {
+	rep, err := NewCommand("PING").Run(c)
+	if err != nil {
+		return err
+	}
+	if rep.IsError() {
+		return ErrPing
+	}
+	return nil
+}
+
 // Close closes the connection
 func (c *Conn) Close() error {
 	c.mutex.Lock()
@@ -97,26 +228,134 @@ func (c *Conn) Unlock() {
 	c.mutex.Unlock()
 }
 
-func (c *Conn) connect(address string, timeout time.Duration) error {
+func (c *Conn) connect(ctx context.Context, address string, timeout time.Duration) error {
 	if c.state == connStateConnected {
 		return nil
 	}
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
 	var err error
 	c.address = address
-	if timeout == 0 {
-		c.tcpConn, err = net.Dial("tcp", address)
-	} else {
-		c.tcpConn, err = net.DialTimeout("tcp", address, timeout)
+	if timeout == 0 && c.options != nil {
+		timeout = c.options.ConnectTimeout
 	}
-	if err == nil {
-		c.state = connStateConnected
-		c.rb = bufio.NewReader(c.tcpConn)
-		c.wb = bufio.NewWriter(c.tcpConn)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	return err
+	c.tcpConn, err = c.options.dial(ctx, address)
+	if err != nil {
+		return err
+	}
+	c.rb = bufio.NewReader(c.tcpConn)
+	c.wb = bufio.NewWriter(c.tcpConn)
+	if err = c.handshake(ctx); err != nil {
+		c.tcpConn.Close()
+		return err
+	}
+	c.tcpConn.SetDeadline(time.Time{})
+	c.lastUsed = time.Now()
+	c.connectedAt = c.lastUsed
+	c.watching = false
+	c.inMulti = false
+	c.state = connStateConnected
+	return nil
 }
 
-func (c *Conn) fail() {
+// handshake prepares a newly opened connection before it is used.
+// Caller must hold the lock.
+func (c *Conn) handshake(ctx context.Context) error {
+	username, password, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	if protocol := c.options.protocol(); protocol != 2 {
+		args := []interface{}{protocol}
+		if password != "" {
+			if username == "" {
+				username = "default"
+			}
+			args = append(args, "AUTH", username, password)
+		}
+		if c.clientName != "" {
+			args = append(args, "SETNAME", c.clientName)
+		}
+		rep, err := c.exec(ctx, NewCommand("HELLO", args...))
+		if err != nil {
+			return err
+		}
+		if rep.IsError() {
+			message, _ := rep.Error()
+			if password != "" && !strings.HasPrefix(message, "NOPROTO") && !strings.HasPrefix(message, "ERR unknown command") {
+				return ErrAuth
+			}
+			return ErrProtocol
+		}
+	} else if password != "" {
+		args := []interface{}{password}
+		if username != "" {
+			args = []interface{}{username, password}
+		}
+		rep, err := c.exec(ctx, NewCommand("AUTH", args...))
+		if err != nil {
+			return err
+		}
+		if !rep.IsOk() {
+			return ErrAuth
+		}
+	}
+	if c.clientName != "" && c.options.protocol() == 2 {
+		rep, err := c.exec(ctx, NewCommand("CLIENT", "SETNAME", c.clientName))
+		if err != nil {
+			return err
+		}
+		if !rep.IsOk() {
+			return ErrClientName
+		}
+	}
+	if c.database != 0 {
+		rep, err := c.exec(ctx, NewCommand("SELECT", c.database))
+		if err != nil {
+			return err
+		}
+		if !rep.IsOk() {
+			return ErrSelect
+		}
+	}
+	return nil
+}
+
+// credentials returns the username and password to authenticate with,
+// from the credentials provider if there is one.
+func (c *Conn) credentials() (string, string, error) {
+	if c.options != nil && c.options.CredentialsProvider != nil {
+		return c.options.CredentialsProvider()
+	}
+	return c.username, c.password, nil
+}
+
+// exec runs a command without locking the connection or failing it on error
+func (c *Conn) exec(ctx context.Context, cmd *Command) (*Reply, error) {
+	c.tcpConn.SetDeadline(deadline(ctx, c.RequestTimeout))
+	if err := cmd.writeCommand(c); err != nil {
+		return nil, ErrWrite
+	}
+	if err := c.wb.Flush(); err != nil {
+		return nil, ErrWrite
+	}
+	return readReply(c)
+}
+
+func (c *Conn) fail(cause error) {
+	c.mutex.Lock()
+	cache := c.cache
+	c.cache = nil
+	c.mutex.Unlock()
+	if cache != nil {
+		// Invalidations are lost while disconnected
+		cache.Flush()
+	}
 	if !c.sentinel {
 		c.mutex.Lock()
 		if c.state == connStateReconnecting {
@@ -125,30 +364,223 @@ func (c *Conn) fail() {
 		}
 		c.tcpConn.Close()
 		c.state = connStateReconnecting
+		c.reconnected = make(chan struct{})
+		reconnected := c.reconnected
+		address := c.address
 		c.mutex.Unlock()
-		go c.reconnect()
+		c.options.emit(&Event{Type: EventDisconnected, Address: address, Err: cause})
+		go c.reconnect(address, reconnected)
 	}
 }
 
-func (c *Conn) reconnect() {
-	sleepTime := Config.ReconnectTime
-	for {
+// reconnect reconnects to address, read by fail under the lock, until it succeeds,
+// the reconnect policy gives up or the connection is closed
+func (c *Conn) reconnect(address string, reconnected chan struct{}) {
+	defer close(reconnected)
+	policy := c.options.reconnectPolicy()
+	for failures := 1; ; failures++ {
+		c.mutex.Lock()
+		closed := c.isClosed
+		c.mutex.Unlock()
+		if closed {
+			break
+		}
+		c.options.emit(&Event{Type: EventReconnecting, Address: address, Attempt: failures})
 		c.mutex.Lock()
 		if c.isClosed {
+			// Closed while the event was emitted
 			c.mutex.Unlock()
 			break
 		}
-		if err := c.connect(c.address, 0); err == nil {
+		err := c.connect(context.Background(), address, 0)
+		c.mutex.Unlock()
+		if err == nil {
+			c.options.emit(&Event{Type: EventReconnected, Address: address, Attempt: failures})
+			break
+		}
+		if err == ErrAuth {
+			c.options.emit(&Event{Type: EventAuthFailed, Address: address, Err: err})
+		}
+		delay, ok := policy.Backoff(failures)
+		if !ok {
+			c.mutex.Lock()
+			c.state = connStateNotConnected
 			c.mutex.Unlock()
+			c.options.emit(&Event{Type: EventGiveUp, Address: address, Attempt: failures, Err: err})
+			c.options.giveUp(address, err)
 			break
 		}
+		time.Sleep(delay)
+	}
+}
+
+// trackSession remembers the commands changing the session state of the
+// connection, so that it can be reset, and the database selected with a raw
+// SELECT, so that it is selected again on reconnection. Caller must hold the lock.
+func (c *Conn) trackSession(cmd *Command) {
+	switch strings.ToUpper(cmd.name) {
+	case "WATCH":
+		c.watching = true
+	case "UNWATCH":
+		c.watching = false
+	case "MULTI":
+		c.inMulti = true
+	case "EXEC", "DISCARD":
+		c.watching = false
+		c.inMulti = false
+	case "SELECT":
+		if len(cmd.args) == 1 {
+			if database, err := strconv.Atoi(string(convertString(cmd.args[0]))); err == nil && database >= 0 {
+				c.database = database
+			}
+		}
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE":
+		c.subscribed = true
+	}
+}
+
+// trackUnsubscribe clears the subscribed state when rep tells that the
+// connection has no subscription left. Caller must hold the lock.
+func (c *Conn) trackUnsubscribe(rep *Reply) {
+	if !c.subscribed || len(rep.arrayValue) != 3 || (!rep.IsArray() && !rep.IsPush()) {
+		return
+	}
+	switch strings.ToLower(string(rep.arrayValue[0].stringValue)) {
+	case "unsubscribe", "punsubscribe", "sunsubscribe":
+		if n, err := rep.arrayValue[2].Int(); err == nil && n == 0 {
+			c.subscribed = false
+		}
+	}
+}
+
+// resetSession discards any open transaction and watched keys, and selects
+// the database of the options again if another one was selected, with Select
+// or a raw SELECT. ErrSubscribed is returned if the connection is subscribed,
+// because it cannot be reset.
+func (c *Conn) resetSession() error {
+	database := 0
+	if c.options != nil {
+		database = c.options.Database
+	}
+	c.mutex.Lock()
+	watching, inMulti, subscribed := c.watching, c.inMulti, c.subscribed
+	selected := c.database != database
+	c.mutex.Unlock()
+	if subscribed {
+		return ErrSubscribed
+	}
+	if inMulti {
+		if _, err := NewCommand("DISCARD").Run(c); err != nil {
+			return err
+		}
+	} else if watching {
+		if _, err := NewCommand("UNWATCH").Run(c); err != nil {
+			return err
+		}
+	}
+	if selected {
+		return c.Select(database)
+	}
+	return nil
+}
+
+// healthCheck pings the connection when it has been idle for interval,
+// until the connection is closed.
+func (c *Conn) healthCheck(interval time.Duration) {
+	period := interval / 2
+	if period < minCheckInterval {
+		period = minCheckInterval
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for range ticker.C {
+		// The connection is checked and pinged under the locks of Go and Send,
+		// so that no command can be sent in between, and the replies of pending
+		// futures are not taken by PING
+		c.futures.mutex.Lock()
+		c.mutex.Lock()
+		if c.isClosed {
+			c.mutex.Unlock()
+			c.futures.mutex.Unlock()
+			return
+		}
+		idle := c.state == connStateConnected && !c.subscribed && !c.futures.receiving &&
+			time.Since(c.lastUsed) >= interval
+		var err error
+		if idle {
+			if _, err = c.exec(context.Background(), NewCommand("PING")); err != nil {
+				c.state = connStateNotConnected
+			}
+		}
 		c.mutex.Unlock()
-		time.Sleep(time.Duration(sleepTime) * time.Second)
-		if sleepTime < 30 {
-			sleepTime += 2
+		c.futures.mutex.Unlock()
+		if err != nil {
+			c.fail(err)
 		}
 	}
-	if c.password != "" {
-		c.Auth(c.password)
+}
+
+// watchContext interrupts any blocking read or write on the connection
+// when ctx is cancelled. The returned function must be called, with the
+// connection still locked, when the operation is done.
+func (c *Conn) watchContext(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	tcpConn := c.tcpConn
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			tcpConn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+func (c *Conn) readTimeout() time.Duration {
+	if c.ReadTimeout != 0 {
+		return c.ReadTimeout
+	}
+	return c.RequestTimeout
+}
+
+func (c *Conn) writeTimeout() time.Duration {
+	if c.WriteTimeout != 0 {
+		return c.WriteTimeout
 	}
+	return c.RequestTimeout
+}
+
+// deadline returns the socket deadline for an operation which should
+// finish after timeout, or sooner if the context has an earlier deadline.
+// A zero time means no deadline, which is the case when timeout is not
+// positive and the context has no deadline.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (t.IsZero() || d.Before(t)) {
+		t = d
+	}
+	return t
+}
+
+// contextError returns the context error if the context is done or its
+// deadline has passed, otherwise err.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
 }
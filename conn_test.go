@@ -0,0 +1,530 @@
+package gore
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeServer is a minimal stand-in for a redis server. Every command
+// received is passed to the handler, which returns the raw reply to write
+// back. An empty reply means the server never answers. When connHandler
+// is set, it is used instead of handler, and can keep the connection to
+// write to it later.
+type fakeServer struct {
+	listener    net.Listener
+	handler     func(args []string) string
+	connHandler func(c net.Conn, args []string) string
+}
+
+func newFakeServer(t *testing.T, handler func(args []string) string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startFakeServer(l, handler)
+}
+
+func startFakeServer(l net.Listener, handler func(args []string) string) *fakeServer {
+	s := &fakeServer{
+		listener: l,
+		handler:  handler,
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *fakeServer) handle(c net.Conn) {
+	defer c.Close()
+	rb := bufio.NewReader(c)
+	for {
+		args, err := readFakeCommand(rb)
+		if err != nil {
+			return
+		}
+		var rep string
+		if s.connHandler != nil {
+			rep = s.connHandler(c, args)
+		} else {
+			rep = s.handler(args)
+		}
+		if rep != "" {
+			c.Write([]byte(rep))
+		}
+	}
+}
+
+func readFakeCommand(rb *bufio.Reader) ([]string, error) {
+	line, err := rb.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[0] != '*' {
+		return nil, ErrRead
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = rb.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 3 || line[0] != '$' {
+			return nil, ErrRead
+		}
+		l, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l+2)
+		if _, err = io.ReadFull(rb, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:l])
+	}
+	return args, nil
+}
+
+func TestRunContext(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "BLPOP" {
+			return ""
+		}
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	conn, err := Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rep, err := NewCommand("PING").RunContext(context.Background(), conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewCommand("BLPOP", "queue", 0).RunContext(ctx, conn)
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("deadline was not applied", time.Since(start))
+	}
+	if conn.IsConnected() {
+		t.Fatal("aborted connection should be reconnected")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = NewCommand("PING").RunContext(ctx, conn); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireContext(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err := pool.AcquireContext(context.Background())
+	if err != nil || conn == nil {
+		t.Fatal(err, conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.AcquireContext(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	pool.Release(conn)
+	conn, err = pool.AcquireContext(context.Background())
+	if err != nil || conn == nil {
+		t.Fatal(err, conn)
+	}
+	pool.Release(conn)
+}
+
+func TestAuth(t *testing.T) {
+	auths := make(chan []string, 10)
+	s := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "AUTH", "HELLO":
+			auths <- args
+			if args[len(args)-1] == "wrong" {
+				return "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+			}
+			return "+OK\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if args := <-auths; len(args) != 3 || args[1] != "alice" || args[2] != "secret" {
+		t.Fatal(args)
+	}
+	conn, err = DialWithOptions(s.Addr(), &Options{Username: "alice", Password: "secret", Protocol: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if args := <-auths; len(args) != 5 || args[1] != "3" || args[2] != "AUTH" || args[3] != "alice" {
+		t.Fatal(args)
+	}
+	if _, err = DialWithOptions(s.Addr(), &Options{Password: "wrong"}); err != ErrAuth {
+		t.Fatal(err)
+	}
+	<-auths
+
+	rotation := 0
+	conn, err = DialWithOptions(s.Addr(), &Options{
+		CredentialsProvider: func() (string, string, error) {
+			rotation++
+			return "bob", "secret" + strconv.Itoa(rotation), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if args := <-auths; args[1] != "bob" || args[2] != "secret1" {
+		t.Fatal(args)
+	}
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	if args := <-auths; args[1] != "bob" || args[2] != "secret2" {
+		t.Fatal(args)
+	}
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		Username:    "carol",
+		Password:    "secret",
+	}
+	if err = pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if args := <-auths; args[1] != "carol" || args[2] != "secret" {
+		t.Fatal(args)
+	}
+}
+
+func TestSelectAndClientName(t *testing.T) {
+	commands := make(chan []string, 10)
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "PING" {
+			return "+PONG\r\n"
+		}
+		commands <- args
+		return "+OK\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{Database: 3, ClientName: "worker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if args := <-commands; len(args) != 3 || args[0] != "CLIENT" || args[2] != "worker" {
+		t.Fatal(args)
+	}
+	if args := <-commands; len(args) != 2 || args[0] != "SELECT" || args[1] != "3" {
+		t.Fatal(args)
+	}
+	if err = conn.Select(5); err != nil {
+		t.Fatal(err)
+	}
+	<-commands
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	if args := <-commands; args[0] != "CLIENT" {
+		t.Fatal(args)
+	}
+	if args := <-commands; args[0] != "SELECT" || args[1] != "5" {
+		t.Fatal(args)
+	}
+	// A raw SELECT is kept across reconnections too
+	for {
+		if _, err = NewCommand("SELECT", 6).Run(conn); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-commands
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	if args := <-commands; args[0] != "CLIENT" {
+		t.Fatal(args)
+	}
+	if args := <-commands; args[0] != "SELECT" || args[1] != "6" {
+		t.Fatal(args)
+	}
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		Options:     &Options{Database: 2},
+	}
+	if err = pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if args := <-commands; args[0] != "SELECT" || args[1] != "2" {
+		t.Fatal(args)
+	}
+}
+
+func TestEventListener(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "AUTH" && args[1] == "wrong" {
+			return "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer s.Close()
+
+	events := make(chan *Event, 10)
+	options := &Options{
+		EventListener: func(e *Event) {
+			events <- e
+		},
+	}
+	conn, err := DialWithOptions(s.Addr(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if e := <-events; e.Type != EventConnected || e.Address != s.Addr() {
+		t.Fatal(e)
+	}
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	for _, expected := range []EventType{EventDisconnected, EventReconnecting, EventReconnected} {
+		e := <-events
+		if e.Type != expected || e.Address != s.Addr() {
+			t.Fatal(expected, e)
+		}
+		if expected == EventDisconnected && e.Err != ErrRead {
+			t.Fatal(e.Err)
+		}
+		if expected != EventDisconnected && e.Attempt != 1 {
+			t.Fatal(e.Attempt)
+		}
+	}
+
+	options.Password = "wrong"
+	if _, err = DialWithOptions(s.Addr(), options); err != ErrAuth {
+		t.Fatal(err)
+	}
+	if e := <-events; e.Type != EventAuthFailed || e.Err != ErrAuth {
+		t.Fatal(e)
+	}
+
+	// No event is emitted after the connection is closed
+	options.Password = ""
+	options.ReconnectPolicy = &LinearBackoff{Step: 20 * time.Millisecond}
+	conn, err = DialWithOptions(s.Addr(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-events
+	s.Close()
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	for _, expected := range []EventType{EventDisconnected, EventReconnecting} {
+		if e := <-events; e.Type != expected {
+			t.Fatal(expected, e)
+		}
+	}
+	conn.Close()
+	select {
+	case e := <-events:
+		t.Fatal("event after close", e)
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestPingAndHealthCheck(t *testing.T) {
+	pings := make(chan bool, 10)
+	answer := make(chan bool, 10)
+	answer <- true
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] != "PING" {
+			return "+OK\r\n"
+		}
+		pings <- true
+		select {
+		case <-answer:
+			return "+PONG\r\n"
+		default:
+			return ""
+		}
+	})
+	defer s.Close()
+
+	events := make(chan *Event, 10)
+	conn, err := DialWithOptions(s.Addr(), &Options{
+		RequestTimeout:      50 * time.Millisecond,
+		HealthCheckInterval: 20 * time.Millisecond,
+		KeepAlive:           time.Second,
+		EventListener: func(e *Event) {
+			events <- e
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-events
+	// The first health check is answered, the next one times out
+	<-pings
+	<-pings
+	if e := <-events; e.Type != EventDisconnected {
+		t.Fatal(e)
+	}
+	if e := <-events; e.Type != EventReconnecting {
+		t.Fatal(e)
+	}
+	if e := <-events; e.Type != EventReconnected {
+		t.Fatal(e)
+	}
+	answer <- true
+	if err = conn.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthCheckShortInterval(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	// An interval shorter than the ticker resolution must not panic
+	conn, err := DialWithOptions(s.Addr(), &Options{HealthCheckInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(5 * time.Millisecond)
+	if err = conn.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthCheckWithFutures(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "ECHO" {
+			return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{HealthCheckInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// PING must never be sent between a command and its reply
+	for i := 0; i < 200; i++ {
+		futures := make([]*Future, 5)
+		for j := range futures {
+			futures[j] = NewCommand("ECHO", strconv.Itoa(j)).Go(conn)
+		}
+		for j, f := range futures {
+			rep, err := f.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s, _ := rep.String(); s != strconv.Itoa(j) {
+				t.Fatal(i, j, s)
+			}
+		}
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+	}
+}
+
+func TestHealthCheckWithTransactions(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "SET":
+			return "+QUEUED\r\n"
+		case "EXEC":
+			time.Sleep(time.Millisecond)
+			return "*1\r\n+OK\r\n"
+		case "PING":
+			return "+PONG\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{HealthCheckInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// PING must never be sent while a transaction is committed
+	for i := 0; i < 100; i++ {
+		tr := NewTransaction(conn)
+		tr.Add(NewCommand("SET", "key", i))
+		replies, err := tr.Commit()
+		if err != nil || len(replies) != 1 || !replies[0].IsOk() {
+			t.Fatal(i, err, replies)
+		}
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+	}
+}
@@ -29,4 +29,28 @@ var (
 	ErrWrite = errors.New("write error")
 	// ErrRead is returned when connection cannot be read
 	ErrRead = errors.New("read error")
+	// ErrSelect is returned when redis SELECT fail
+	ErrSelect = errors.New("select fail")
+	// ErrClientName is returned when redis CLIENT SETNAME fail
+	ErrClientName = errors.New("client name fail")
+	// ErrInvalidURL is returned when a redis URL cannot be parsed
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrProtocol is returned when redis server refuses the requested protocol version
+	ErrProtocol = errors.New("protocol not supported")
+	// ErrPing is returned when redis answers PING with an error
+	ErrPing = errors.New("ping fail")
+	// ErrPoolTimeout is returned when no connection of the pool is released within AcquireTimeout
+	ErrPoolTimeout = errors.New("pool acquire timeout")
+	// ErrPoolExhausted is returned when too many goroutines are already waiting for a connection of the pool
+	ErrPoolExhausted = errors.New("pool exhausted")
+	// ErrSubscribed is returned when a connection in subscribed state cannot be reset
+	ErrSubscribed = errors.New("connection is subscribed")
+	// ErrPoolClosed is returned by pool helpers when the pool was closed
+	ErrPoolClosed = errors.New("pool closed")
+	// ErrTooManyRedirects is returned when a command is redirected by
+	// MOVED or ASK more than the allowed number of times
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrCrossShard is returned when the keys of a command sent to a cluster
+	// belong to different shards, or different hash slots with Redis Cluster
+	ErrCrossShard = errors.New("keys in different shards")
 )
@@ -0,0 +1,47 @@
+package gore
+
+// EventType is the kind of an Event
+type EventType int
+
+// Event types
+const (
+	// EventConnected is sent when a connection is opened by Dial
+	EventConnected EventType = iota + 1
+	// EventDisconnected is sent when a connection fails, with the cause in Err
+	EventDisconnected
+	// EventReconnecting is sent before each reconnection attempt, numbered by Attempt
+	EventReconnecting
+	// EventReconnected is sent when a failed connection is opened again
+	EventReconnected
+	// EventAuthFailed is sent when redis server refuses the credentials
+	EventAuthFailed
+	// EventGiveUp is sent when the ReconnectPolicy gives up, with the last error in Err
+	EventGiveUp
+	// EventInstanceDown is sent when sentinel reports the instance Name as down
+	EventInstanceDown
+	// EventInstanceUp is sent when sentinel reports the instance Name as up again
+	EventInstanceUp
+	// EventFailover is sent when sentinel switches the instance Name to a new master at Address
+	EventFailover
+)
+
+// Event describes a change of connection state
+type Event struct {
+	Type EventType
+	// Address of the redis or sentinel server
+	Address string
+	// Name of the monitored instance for sentinel events
+	Name string
+	// Attempt is the reconnection attempt number, starting at 1
+	Attempt int
+	// Err is the cause of the event, if any
+	Err error
+}
+
+// emit sends an event to the event listener of the options, if any.
+// It must be called without holding any lock.
+func (o *Options) emit(event *Event) {
+	if o != nil && o.EventListener != nil {
+		o.EventListener(event)
+	}
+}
@@ -0,0 +1,135 @@
+package gore
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Future is the result of a command sent with Command.Go, which will be
+// available once the reply is received
+type Future struct {
+	done  chan struct{}
+	reply *Reply
+	err   error
+	cmd   *Command
+}
+
+// Wait waits for the reply of the command and returns it, like Command.Run
+func (f *Future) Wait() (*Reply, error) {
+	<-f.done
+	return f.reply, f.err
+}
+
+// Done returns a channel which is closed when the reply has been received
+// or the command has failed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *Future) resolve(reply *Reply, err error) {
+	f.reply = reply
+	f.err = err
+	close(f.done)
+}
+
+// futureQueue keeps the futures of a connection waiting for their reply,
+// in the order their commands were sent
+type futureQueue struct {
+	mutex     sync.Mutex
+	futures   []*Future
+	receiving bool
+}
+
+// Go sends command to redis without waiting for its reply, and returns a Future
+// for the reply. Several commands can be sent with Go before waiting for any of
+// them, saving network roundtrips like a Pipeline. Replies are received in the
+// background in the order the commands were sent, without blocking the commands
+// sent meanwhile.
+//
+// While futures of a connection are pending, the connection must not be used for
+// Run, Send or Receive, because they would take replies belonging to the futures.
+// Use Go with a connection acquired from a Pool, or with a dedicated connection.
+func (cmd *Command) Go(conn *Conn) *Future {
+	f := &Future{
+		done: make(chan struct{}),
+		cmd:  cmd,
+	}
+	q := &conn.futures
+	q.mutex.Lock()
+	// Checked under the lock of the queue, which a failed receiver holds
+	// until the connection is marked as not connected
+	conn.Lock()
+	connected := conn.state == connStateConnected
+	conn.Unlock()
+	if !connected {
+		q.mutex.Unlock()
+		f.resolve(nil, ErrNotConnected)
+		return f
+	}
+	if err := cmd.Send(conn); err != nil {
+		q.mutex.Unlock()
+		f.resolve(nil, err)
+		return f
+	}
+	q.futures = append(q.futures, f)
+	start := !q.receiving
+	q.receiving = true
+	q.mutex.Unlock()
+	if start {
+		go q.receive(conn)
+	}
+	return f
+}
+
+// receive reads replies for the pending futures until there is none left.
+// When a read fails, the connection is reconnected, so every pending future
+// fails with the same error. The queue is emptied before the reconnection
+// starts, so that commands sent with Go on the new connection are never
+// failed while their reply is still to be read.
+func (q *futureQueue) receive(conn *Conn) {
+	for {
+		q.mutex.Lock()
+		if len(q.futures) == 0 {
+			q.receiving = false
+			q.mutex.Unlock()
+			return
+		}
+		f := q.futures[0]
+		q.futures = q.futures[1:]
+		q.mutex.Unlock()
+		rep, tcpConn, err := q.read(conn, f.cmd)
+		f.resolve(rep, err)
+		if err != nil {
+			q.mutex.Lock()
+			for _, f := range q.futures {
+				f.resolve(nil, err)
+			}
+			q.futures = nil
+			q.receiving = false
+			// Go takes the locks in the same order
+			conn.Lock()
+			current := conn.tcpConn == tcpConn && conn.state == connStateConnected
+			if current {
+				conn.state = connStateNotConnected
+			}
+			conn.Unlock()
+			q.mutex.Unlock()
+			if current {
+				conn.fail(err)
+			}
+			return
+		}
+	}
+}
+
+// read reads the reply of cmd without locking the connection, which stays
+// free for Go to send more commands, and returns the connection it was read from.
+func (q *futureQueue) read(conn *Conn, cmd *Command) (*Reply, net.Conn, error) {
+	conn.readMutex.Lock()
+	defer conn.readMutex.Unlock()
+	tcpConn := conn.tcpConn
+	tcpConn.SetReadDeadline(deadline(context.Background(), cmd.readTimeout(conn.readTimeout())))
+	rep, err := readReply(conn)
+	return rep, tcpConn, err
+}
@@ -0,0 +1,122 @@
+package gore
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFuture(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "ECHO" {
+			return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	defer s.Close()
+
+	conn, err := Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	futures := make([]*Future, 50)
+	for i := range futures {
+		futures[i] = NewCommand("ECHO", strconv.Itoa(i)).Go(conn)
+	}
+	unknown := NewCommand("UNKNOWN").Go(conn)
+	<-futures[len(futures)-1].Done()
+	for i, f := range futures {
+		rep, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := rep.String(); s != strconv.Itoa(i) {
+			t.Fatal(i, s)
+		}
+	}
+	if rep, err := unknown.Wait(); err != nil || !rep.IsError() {
+		t.Fatal(rep, err)
+	}
+
+	conn.Close()
+	if _, err = NewCommand("ECHO", "closed").Go(conn).Wait(); err != ErrNotConnected {
+		t.Fatal(err)
+	}
+}
+
+func TestFutureSlowServer(t *testing.T) {
+	received := make(chan struct{})
+	s := newFakeServer(t, func(args []string) string {
+		if args[1] == "0" {
+			close(received)
+			time.Sleep(200 * time.Millisecond)
+		}
+		return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+	})
+	defer s.Close()
+
+	conn, err := Dial(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Commands are written while the reply of the first one is awaited
+	futures := make([]*Future, 10)
+	futures[0] = NewCommand("ECHO", "0").Go(conn)
+	<-received
+	time.Sleep(20 * time.Millisecond)
+	for i := 1; i < len(futures); i++ {
+		futures[i] = NewCommand("ECHO", strconv.Itoa(i)).Go(conn)
+	}
+	select {
+	case <-futures[0].Done():
+		t.Fatal("commands were sent after the first reply")
+	default:
+	}
+	for i, f := range futures {
+		rep, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := rep.String(); s != strconv.Itoa(i) {
+			t.Fatal(i, s)
+		}
+	}
+}
+
+func TestFutureReconnect(t *testing.T) {
+	s := newFakeServer(t, nil)
+	s.connHandler = func(c net.Conn, args []string) string {
+		if args[0] == "QUIT" {
+			c.Close()
+			return ""
+		}
+		return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+	}
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{ReconnectTime: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err = NewCommand("QUIT").Go(conn).Wait(); err == nil {
+		t.Fatal("read did not fail")
+	}
+	// Commands sent while and after reconnecting get their own reply
+	for i := 0; i < 200; i++ {
+		rep, err := NewCommand("ECHO", strconv.Itoa(i)).Go(conn).Wait()
+		if err != nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if s, _ := rep.String(); s != strconv.Itoa(i) {
+			t.Fatal("stale reply", i, s)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gore
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of points of each node on a HashRing
+// when the number of virtual nodes is not set, as in ketama
+const DefaultVirtualNodes = 160
+
+// HashRing is a ketama consistent hash ring. Each node is placed on the ring
+// many times, as virtual nodes, at positions computed from its name only, so
+// the ring does not depend on the order of the nodes, and adding or removing
+// a node only moves the keys of that node.
+type HashRing struct {
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash uint32
+	node int
+}
+
+// NewHashRing returns a ring of nodes identified by their names. weights, if not nil,
+// gives the relative weight of each node: a node of weight 2 gets twice the virtual
+// nodes, and about twice the keys, of a node of weight 1.
+func NewHashRing(names []string, weights []int, virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &HashRing{}
+	for node, name := range names {
+		weight := 1
+		if node < len(weights) && weights[node] > 0 {
+			weight = weights[node]
+		}
+		// Each md5 digest gives 4 points
+		for i := 0; i < (virtualNodes*weight+3)/4; i++ {
+			digest := md5.Sum([]byte(name + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				r.points = append(r.points, ringPoint{
+					hash: binary.LittleEndian.Uint32(digest[j*4:]),
+					node: node,
+				})
+			}
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return names[r.points[i].node] < names[r.points[j].node]
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r
+}
+
+// Get returns the index of the node of a key, or -1 if the ring is empty
+func (r *HashRing) Get(key string) int {
+	if len(r.points) == 0 {
+		return -1
+	}
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+// ConsistentShardStrategy returns a ShardStrategy using a HashRing of the shards.
+// names must be stable identities of the shards, such as their addresses, in the
+// same order as the shards of the cluster.
+func ConsistentShardStrategy(names []string, weights []int, virtualNodes int) func(string, int) int {
+	ring := NewHashRing(names, weights, virtualNodes)
+	return func(key string, size int) int {
+		return ring.Get(key)
+	}
+}
@@ -0,0 +1,58 @@
+package gore
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRing(t *testing.T) {
+	names := []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}
+	ring := NewHashRing(names, nil, 0)
+	counts := make([]int, len(names))
+	for i := 0; i < 30000; i++ {
+		counts[ring.Get("key"+strconv.Itoa(i))]++
+	}
+	for i, count := range counts {
+		if count < 8000 || count > 12000 {
+			t.Fatal("keys are not balanced", i, counts)
+		}
+	}
+
+	// The order of the nodes does not matter
+	reversed := NewHashRing([]string{names[2], names[1], names[0]}, nil, 0)
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if names[ring.Get(key)] != names[2-reversed.Get(key)] {
+			t.Fatal("ring depends on node order", key)
+		}
+	}
+
+	// Adding a node only moves keys to the new node
+	grown := NewHashRing(append(names, "10.0.0.4:6379"), nil, 0)
+	moved := 0
+	for i := 0; i < 30000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if before, after := ring.Get(key), grown.Get(key); before != after {
+			if after != 3 {
+				t.Fatal("key moved between old nodes", key)
+			}
+			moved++
+		}
+	}
+	if moved < 5000 || moved > 10000 {
+		t.Fatal("too many or too few keys moved", moved)
+	}
+
+	weighted := NewHashRing(names, []int{1, 2, 1}, 0)
+	counts = make([]int, len(names))
+	for i := 0; i < 30000; i++ {
+		counts[weighted.Get("key"+strconv.Itoa(i))]++
+	}
+	if counts[1] < counts[0]*3/2 || counts[1] < counts[2]*3/2 {
+		t.Fatal("weights are not used", counts)
+	}
+
+	if NewHashRing(nil, nil, 0).Get("key") != -1 {
+		t.Fatal("empty ring should not return a node")
+	}
+}
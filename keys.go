@@ -0,0 +1,323 @@
+package gore
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// keyFunc returns the positions of the keys among the arguments of a command
+type keyFunc func(args []interface{}) []int
+
+// commandKeys tells where the keys of commands are. Commands which are not in
+// this table, nor loaded with LoadCommandKeys, have their first argument as only key.
+var commandKeys = map[string]keyFunc{
+	// Commands without key
+	"ACL":          noKeys,
+	"ASKING":       noKeys,
+	"AUTH":         noKeys,
+	"BGREWRITEAOF": noKeys,
+	"BGSAVE":       noKeys,
+	"CLIENT":       noKeys,
+	"CLUSTER":      noKeys,
+	"COMMAND":      noKeys,
+	"CONFIG":       noKeys,
+	"DBSIZE":       noKeys,
+	"DISCARD":      noKeys,
+	"ECHO":         noKeys,
+	"EXEC":         noKeys,
+	"FLUSHALL":     noKeys,
+	"FLUSHDB":      noKeys,
+	"FUNCTION":     noKeys,
+	"HELLO":        noKeys,
+	"INFO":         noKeys,
+	"KEYS":         noKeys,
+	"LASTSAVE":     noKeys,
+	"LATENCY":      noKeys,
+	"MULTI":        noKeys,
+	"PING":         noKeys,
+	"PSUBSCRIBE":   noKeys,
+	"PUBLISH":      noKeys,
+	"PUBSUB":       noKeys,
+	"PUNSUBSCRIBE": noKeys,
+	"QUIT":         noKeys,
+	"RANDOMKEY":    noKeys,
+	"READONLY":     noKeys,
+	"READWRITE":    noKeys,
+	"ROLE":         noKeys,
+	"SAVE":         noKeys,
+	"SCAN":         noKeys,
+	"SCRIPT":       noKeys,
+	"SELECT":       noKeys,
+	"SLOWLOG":      noKeys,
+	"SUBSCRIBE":    noKeys,
+	"SWAPDB":       noKeys,
+	"TIME":         noKeys,
+	"UNSUBSCRIBE":  noKeys,
+	"UNWATCH":      noKeys,
+	"WAIT":         noKeys,
+	"WAITAOF":      noKeys,
+	// Every argument is a key
+	"DEL":         keyRange(0, -1, 1),
+	"EXISTS":      keyRange(0, -1, 1),
+	"MGET":        keyRange(0, -1, 1),
+	"PFCOUNT":     keyRange(0, -1, 1),
+	"PFMERGE":     keyRange(0, -1, 1),
+	"SDIFF":       keyRange(0, -1, 1),
+	"SDIFFSTORE":  keyRange(0, -1, 1),
+	"SINTER":      keyRange(0, -1, 1),
+	"SINTERSTORE": keyRange(0, -1, 1),
+	"SUNION":      keyRange(0, -1, 1),
+	"SUNIONSTORE": keyRange(0, -1, 1),
+	"TOUCH":       keyRange(0, -1, 1),
+	"UNLINK":      keyRange(0, -1, 1),
+	"WATCH":       keyRange(0, -1, 1),
+	// Keys and values
+	"MSET":   keyRange(0, -1, 2),
+	"MSETNX": keyRange(0, -1, 2),
+	// Blocking commands, with the timeout last
+	"BLPOP":    keyRange(0, -2, 1),
+	"BRPOP":    keyRange(0, -2, 1),
+	"BZPOPMAX": keyRange(0, -2, 1),
+	"BZPOPMIN": keyRange(0, -2, 1),
+	// Source and destination keys
+	"BLMOVE":         keyRange(0, 1, 1),
+	"BRPOPLPUSH":     keyRange(0, 1, 1),
+	"COPY":           keyRange(0, 1, 1),
+	"GEOSEARCHSTORE": keyRange(0, 1, 1),
+	"LCS":            keyRange(0, 1, 1),
+	"LMOVE":          keyRange(0, 1, 1),
+	"RENAME":         keyRange(0, 1, 1),
+	"RENAMENX":       keyRange(0, 1, 1),
+	"RPOPLPUSH":      keyRange(0, 1, 1),
+	"SMOVE":          keyRange(0, 1, 1),
+	"ZRANGESTORE":    keyRange(0, 1, 1),
+	// The operation, or a subcommand, comes first
+	"BITOP":  keyRange(1, -1, 1),
+	"MEMORY": keyRange(1, 1, 1),
+	"OBJECT": keyRange(1, 1, 1),
+	"XGROUP": keyRange(1, 1, 1),
+	"XINFO":  keyRange(1, 1, 1),
+	// The number of keys comes before the keys
+	"EVAL":        numKeys(1),
+	"EVALSHA":     numKeys(1),
+	"EVALSHA_RO":  numKeys(1),
+	"EVAL_RO":     numKeys(1),
+	"FCALL":       numKeys(1),
+	"FCALL_RO":    numKeys(1),
+	"LMPOP":       numKeys(0),
+	"SINTERCARD":  numKeys(0),
+	"ZDIFF":       numKeys(0),
+	"ZINTER":      numKeys(0),
+	"ZINTERCARD":  numKeys(0),
+	"ZMPOP":       numKeys(0),
+	"ZUNION":      numKeys(0),
+	"BLMPOP":      numKeys(1),
+	"BZMPOP":      numKeys(1),
+	"ZDIFFSTORE":  joinKeys(keyRange(0, 0, 1), numKeys(1)),
+	"ZINTERSTORE": joinKeys(keyRange(0, 0, 1), numKeys(1)),
+	"ZUNIONSTORE": joinKeys(keyRange(0, 0, 1), numKeys(1)),
+	// The destination key follows STORE or STOREDIST, after other options
+	"SORT":              storeKeys(1, map[string]int{"BY": 1, "LIMIT": 2, "GET": 1}),
+	"SORT_RO":           storeKeys(1, map[string]int{"BY": 1, "LIMIT": 2, "GET": 1}),
+	"GEORADIUS":         storeKeys(5, map[string]int{"COUNT": 1}),
+	"GEORADIUSBYMEMBER": storeKeys(4, map[string]int{"COUNT": 1}),
+	// Other commands
+	"XREAD":      streamKeys,
+	"XREADGROUP": streamKeys,
+	"MIGRATE":    migrateKeys,
+}
+
+var (
+	loadedKeysMutex sync.RWMutex
+	loadedKeys      = map[string]keyFunc{}
+)
+
+// Keys returns the keys of the command, used to route it to a shard or a cluster
+// node. The keys of commands unknown to gore, and not loaded with LoadCommandKeys,
+// are assumed to be their first argument only.
+func (cmd *Command) Keys() []string {
+	positions := cmd.keyPositions()
+	keys := make([]string, len(positions))
+	for i, position := range positions {
+		keys[i] = string(convertString(cmd.args[position]))
+	}
+	return keys
+}
+
+// keyPositions returns the positions of the keys among the arguments of the command
+func (cmd *Command) keyPositions() []int {
+	name := strings.ToUpper(cmd.name)
+	f, ok := commandKeys[name]
+	if !ok {
+		loadedKeysMutex.RLock()
+		f, ok = loadedKeys[name]
+		loadedKeysMutex.RUnlock()
+	}
+	if !ok {
+		f = keyRange(0, 0, 1)
+	}
+	return f(cmd.args)
+}
+
+// LoadCommandKeys loads the key positions of the commands of a redis server with COMMAND,
+// for the commands gore does not know, such as commands of modules. Commands whose keys
+// cannot be found from their position, flagged with movablekeys, are ignored. Commands
+// loaded from several servers are all kept, the last loaded position winning.
+func LoadCommandKeys(conn *Conn) error {
+	rep, err := NewCommand("COMMAND").Run(conn)
+	if err != nil {
+		return err
+	}
+	entries, err := rep.Array()
+	if err != nil {
+		return err
+	}
+	loaded := map[string]keyFunc{}
+	for _, entry := range entries {
+		fields, err := entry.Array()
+		if err != nil || len(fields) < 6 {
+			return ErrType
+		}
+		name, err := fields[0].String()
+		if err != nil {
+			return err
+		}
+		flags, err := fields[2].Array()
+		if err != nil {
+			return err
+		}
+		movable := false
+		for _, flag := range flags {
+			if s, _ := flag.String(); s == "movablekeys" {
+				movable = true
+			}
+		}
+		first, err1 := fields[3].Int()
+		last, err2 := fields[4].Int()
+		step, err3 := fields[5].Int()
+		if err1 != nil || err2 != nil || err3 != nil {
+			return ErrConvert
+		}
+		name = strings.ToUpper(name)
+		if _, ok := commandKeys[name]; ok || movable {
+			continue
+		}
+		// Positions of COMMAND count the command name
+		if step <= 0 || first <= 0 {
+			loaded[name] = noKeys
+			continue
+		}
+		if last > 0 {
+			last--
+		}
+		loaded[name] = keyRange(int(first-1), int(last), int(step))
+	}
+	loadedKeysMutex.Lock()
+	for name, f := range loaded {
+		loadedKeys[name] = f
+	}
+	loadedKeysMutex.Unlock()
+	return nil
+}
+
+func noKeys(args []interface{}) []int {
+	return nil
+}
+
+// keyRange returns a keyFunc of keys from first to last, every step arguments.
+// A negative last is counted from the end, -1 being the last argument.
+func keyRange(first, last, step int) keyFunc {
+	return func(args []interface{}) []int {
+		end := last
+		if end < 0 {
+			end += len(args)
+		}
+		if end >= len(args) {
+			end = len(args) - 1
+		}
+		positions := []int{}
+		for i := first; i <= end; i += step {
+			positions = append(positions, i)
+		}
+		return positions
+	}
+}
+
+// numKeys returns a keyFunc of keys following their number, at position
+func numKeys(position int) keyFunc {
+	return func(args []interface{}) []int {
+		if position >= len(args) {
+			return nil
+		}
+		n, err := strconv.Atoi(string(convertString(args[position])))
+		if err != nil || n <= 0 {
+			return nil
+		}
+		return keyRange(position+1, position+n, 1)(args)
+	}
+}
+
+// joinKeys returns a keyFunc of the keys of every f
+func joinKeys(fs ...keyFunc) keyFunc {
+	return func(args []interface{}) []int {
+		positions := []int{}
+		for _, f := range fs {
+			positions = append(positions, f(args)...)
+		}
+		return positions
+	}
+}
+
+// streamKeys returns the keys of XREAD and XREADGROUP, which are the first half
+// of the arguments after STREAMS, the second half being the IDs
+func streamKeys(args []interface{}) []int {
+	for i, arg := range args {
+		if strings.ToUpper(string(convertString(arg))) == "STREAMS" {
+			n := (len(args) - i - 1) / 2
+			return keyRange(i+1, i+n, 1)(args)
+		}
+	}
+	return nil
+}
+
+// storeKeys returns a keyFunc of the first argument and of the keys following
+// STORE or STOREDIST, among the options after the fixed first arguments. options
+// are the numbers of values of the other options, which are skipped.
+func storeKeys(fixed int, options map[string]int) keyFunc {
+	return func(args []interface{}) []int {
+		if len(args) == 0 {
+			return nil
+		}
+		positions := []int{0}
+		for i := fixed; i < len(args); i++ {
+			switch option := strings.ToUpper(string(convertString(args[i]))); option {
+			case "STORE", "STOREDIST":
+				if i+1 < len(args) {
+					positions = append(positions, i+1)
+				}
+				i++
+			default:
+				i += options[option]
+			}
+		}
+		return positions
+	}
+}
+
+// migrateKeys returns the keys of MIGRATE host port key db timeout, or, if key
+// is empty, of MIGRATE host port "" db timeout ... KEYS key [key ...]
+func migrateKeys(args []interface{}) []int {
+	if len(args) < 3 {
+		return nil
+	}
+	if len(convertString(args[2])) > 0 {
+		return []int{2}
+	}
+	for i := 5; i < len(args); i++ {
+		if strings.ToUpper(string(convertString(args[i]))) == "KEYS" {
+			return keyRange(i+1, -1, 1)(args)
+		}
+	}
+	return nil
+}
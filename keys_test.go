@@ -0,0 +1,145 @@
+package gore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandKeys(t *testing.T) {
+	tests := []struct {
+		cmd  *Command
+		keys []string
+	}{
+		{NewCommand("GET", "kirisame"), []string{"kirisame"}},
+		{NewCommand("get", "kirisame"), []string{"kirisame"}},
+		{NewCommand("GET"), []string{}},
+		{NewCommand("PING"), []string{}},
+		{NewCommand("INFO", "server"), []string{}},
+		{NewCommand("MGET", "a", "b", "c"), []string{"a", "b", "c"}},
+		{NewCommand("MSET", "a", 1, "b", 2), []string{"a", "b"}},
+		{NewCommand("BLPOP", "a", "b", 5), []string{"a", "b"}},
+		{NewCommand("EVAL", "return 1", 2, "a", "b", "c"), []string{"a", "b"}},
+		{NewCommand("EVALSHA", "sha", 0, "a"), []string{}},
+		{NewCommand("ZUNIONSTORE", "dest", 2, "a", "b", "WEIGHTS", 1, 2), []string{"dest", "a", "b"}},
+		{NewCommand("ZINTER", 2, "a", "b"), []string{"a", "b"}},
+		{NewCommand("BLMPOP", 5, 2, "a", "b", "LEFT"), []string{"a", "b"}},
+		{NewCommand("BITOP", "AND", "dest", "a", "b"), []string{"dest", "a", "b"}},
+		{NewCommand("OBJECT", "ENCODING", "a"), []string{"a"}},
+		{NewCommand("RENAME", "a", "b"), []string{"a", "b"}},
+		{NewCommand("XREAD", "COUNT", 2, "STREAMS", "a", "b", "0", "0"), []string{"a", "b"}},
+		{NewCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "a", ">"), []string{"a"}},
+		{NewCommand("MIGRATE", "host", 6379, "a", 0, 1000), []string{"a"}},
+		{NewCommand("MIGRATE", "host", 6379, "", 0, 1000, "REPLACE", "KEYS", "a", "b"), []string{"a", "b"}},
+		{NewCommand("SORT", "a", "BY", "w_*", "LIMIT", 0, 10, "GET", "store", "store", "b"), []string{"a", "b"}},
+		{NewCommand("SORT_RO", "a", "GET", "#", "ALPHA"), []string{"a"}},
+		{NewCommand("GEORADIUS", "a", 15, 37, 200, "km", "COUNT", 5, "ANY", "STORE", "b", "STOREDIST", "c"), []string{"a", "b", "c"}},
+		{NewCommand("GEORADIUSBYMEMBER", "a", "store", 100, "km", "STOREDIST", "b"), []string{"a", "b"}},
+		{NewCommand("MYMODULE.GET", "a", "b"), []string{"a"}},
+	}
+	for _, test := range tests {
+		if keys := test.cmd.Keys(); !reflect.DeepEqual(keys, test.keys) {
+			t.Fatal(test.cmd.name, test.cmd.args, keys, test.keys)
+		}
+	}
+}
+
+// resetLoadedKeys forgets the commands loaded by LoadCommandKeys
+func resetLoadedKeys() {
+	loadedKeysMutex.Lock()
+	loadedKeys = map[string]keyFunc{}
+	loadedKeysMutex.Unlock()
+}
+
+func TestLoadCommandKeys(t *testing.T) {
+	defer resetLoadedKeys()
+	server := newFakeServer(t, func(args []string) string {
+		if args[0] != "COMMAND" {
+			return "-ERR unknown command\r\n"
+		}
+		return "*3\r\n" +
+			"*6\r\n$12\r\nmymodule.set\r\n:-3\r\n*1\r\n+write\r\n:1\r\n:-1\r\n:2\r\n" +
+			"*6\r\n$13\r\nmymodule.info\r\n:1\r\n*0\r\n:0\r\n:0\r\n:0\r\n" +
+			"*6\r\n$3\r\nget\r\n:2\r\n*1\r\n+readonly\r\n:1\r\n:1\r\n:1\r\n"
+	})
+	defer server.Close()
+	conn, err := Dial(server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = LoadCommandKeys(conn); err != nil {
+		t.Fatal(err)
+	}
+	if keys := NewCommand("MYMODULE.SET", "a", 1, "b", 2).Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatal(keys)
+	}
+	if keys := NewCommand("MYMODULE.INFO", "a").Keys(); len(keys) != 0 {
+		t.Fatal(keys)
+	}
+	if keys := NewCommand("GET", "a").Keys(); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Fatal(keys)
+	}
+
+	// Commands of another server are added to the loaded ones
+	other := newFakeServer(t, func(args []string) string {
+		return "*1\r\n*6\r\n$9\r\nother.get\r\n:-2\r\n*1\r\n+readonly\r\n:2\r\n:2\r\n:1\r\n"
+	})
+	defer other.Close()
+	otherConn, err := Dial(other.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherConn.Close()
+	if err = LoadCommandKeys(otherConn); err != nil {
+		t.Fatal(err)
+	}
+	if keys := NewCommand("OTHER.GET", "a", "b").Keys(); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Fatal(keys)
+	}
+	if keys := NewCommand("MYMODULE.SET", "a", 1, "b", 2).Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatal("loaded commands were replaced", keys)
+	}
+}
+
+func TestClusterKeys(t *testing.T) {
+	keys := [2]chan string{make(chan string, 10), make(chan string, 10)}
+	servers := [2]*fakeServer{}
+	for i := range servers {
+		i := i
+		servers[i] = newFakeServer(t, func(args []string) string {
+			keys[i] <- args[len(args)-1]
+			return ":1\r\n"
+		})
+		defer servers[i].Close()
+	}
+	c := NewCluster()
+	c.AddShard(servers[0].Addr(), servers[1].Addr())
+	c.ShardStrategy = func(key string, size int) int {
+		if key[0] == 'a' {
+			return 0
+		}
+		return 1
+	}
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	// The script is not a key
+	if _, err := c.Execute(NewCommand("EVAL", "script", 1, "bkey", "aarg")); err != nil {
+		t.Fatal(err)
+	}
+	if <-keys[1] != "aarg" {
+		t.Fatal("EVAL was not routed on its key")
+	}
+	if _, err := c.Execute(NewCommand("DEL", "a1", "a2")); err != nil {
+		t.Fatal(err)
+	}
+	if <-keys[0] != "a2" {
+		t.Fatal("DEL was not routed on its keys")
+	}
+	if _, err := c.Execute(NewCommand("RENAME", "a1", "b1")); err != ErrCrossShard {
+		t.Fatal("expected ErrCrossShard", err)
+	}
+	if _, err := c.Execute(NewCommand("INFO", "server")); err != ErrNoKey {
+		t.Fatal("expected ErrNoKey", err)
+	}
+}
@@ -0,0 +1,162 @@
+package gore
+
+import (
+	"context"
+	"sync"
+)
+
+// muxMaximumBatch limits the number of commands written in one batch
+const muxMaximumBatch = 1024
+
+// MuxConn is a connection which can be shared by many goroutines at the same time.
+// Commands submitted concurrently are coalesced and written to redis in one batch,
+// like a Pipeline, and every reply is matched back to its command in FIFO order.
+// Unlike Conn, a slow round trip does not block other goroutines from queueing
+// their commands, so a single MuxConn can often replace a large Pool.
+//
+// Commands which change the state of the connection, such as SELECT, WATCH, MULTI
+// or SUBSCRIBE, and blocking commands such as BLPOP, must not be run on a MuxConn,
+// because they affect or delay every other command of the batch.
+type MuxConn struct {
+	conn      *Conn
+	requests  chan *muxRequest
+	closed    chan struct{}
+	closeOnce sync.Once
+	done      sync.WaitGroup
+}
+
+type muxRequest struct {
+	ctx   context.Context
+	cmd   *Command
+	reply chan muxResult
+}
+
+type muxResult struct {
+	reply *Reply
+	err   error
+}
+
+// DialMux opens a multiplexed connection with a redis server
+func DialMux(address string) (*MuxConn, error) {
+	return DialMuxWithOptions(address, nil)
+}
+
+// DialMuxWithOptions opens a multiplexed connection with a redis server using options
+func DialMuxWithOptions(address string, options *Options) (*MuxConn, error) {
+	conn, err := DialWithOptions(address, options)
+	if err != nil {
+		return nil, err
+	}
+	return NewMuxConn(conn), nil
+}
+
+// NewMuxConn returns a multiplexed connection sending commands over conn.
+// conn is closed when the MuxConn is closed.
+func NewMuxConn(conn *Conn) *MuxConn {
+	m := &MuxConn{
+		conn:     conn,
+		requests: make(chan *muxRequest),
+		closed:   make(chan struct{}),
+	}
+	m.done.Add(1)
+	go m.loop()
+	return m
+}
+
+// Run sends command to redis and waits for its reply. It can be called from
+// many goroutines at the same time.
+func (m *MuxConn) Run(cmd *Command) (*Reply, error) {
+	return m.RunContext(context.Background(), cmd)
+}
+
+// RunContext sends command to redis and waits for its reply. When ctx is cancelled,
+// RunContext returns immediately. The command may still be sent, but its reply is
+// discarded, so the connection does not need to be reconnected.
+func (m *MuxConn) RunContext(ctx context.Context, cmd *Command) (*Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := &muxRequest{
+		ctx:   ctx,
+		cmd:   cmd,
+		reply: make(chan muxResult, 1),
+	}
+	select {
+	case m.requests <- req:
+	case <-m.closed:
+		return nil, ErrNotConnected
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case result := <-req.reply:
+		return result.reply, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the multiplexed connection and its underlying connection
+func (m *MuxConn) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+	})
+	m.done.Wait()
+	return m.conn.Close()
+}
+
+// IsConnected returns true if connection is okay
+func (m *MuxConn) IsConnected() bool {
+	return m.conn.IsConnected()
+}
+
+// GetAddress returns connection address
+func (m *MuxConn) GetAddress() string {
+	return m.conn.GetAddress()
+}
+
+// loop collects the queued commands into batches and runs them one batch
+// at a time, while new commands are queued for the next batch.
+func (m *MuxConn) loop() {
+	defer m.done.Done()
+	batch := make([]*muxRequest, 0, muxMaximumBatch)
+	for {
+		select {
+		case req := <-m.requests:
+			batch = append(batch[:0], req)
+		case <-m.closed:
+			return
+		}
+	collect:
+		for len(batch) < muxMaximumBatch {
+			select {
+			case req := <-m.requests:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+		m.run(batch)
+	}
+}
+
+func (m *MuxConn) run(batch []*muxRequest) {
+	p := NewPipeline()
+	requests := make([]*muxRequest, 0, len(batch))
+	for _, req := range batch {
+		if req.ctx.Err() != nil {
+			// Nobody is waiting for this reply
+			continue
+		}
+		p.Add(req.cmd)
+		requests = append(requests, req)
+	}
+	replies, err := p.Run(m.conn)
+	for i, req := range requests {
+		if err != nil {
+			req.reply <- muxResult{err: err}
+		} else {
+			req.reply <- muxResult{reply: replies[i]}
+		}
+	}
+}
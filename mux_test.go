@@ -0,0 +1,75 @@
+package gore
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMuxConn(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "ECHO":
+			return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+		case "SLOW":
+			time.Sleep(10 * time.Millisecond)
+			return "+OK\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialMux(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	errors := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			message := strconv.Itoa(i)
+			rep, err := conn.Run(NewCommand("ECHO", message))
+			if err != nil {
+				errors <- err.Error()
+				return
+			}
+			if s, _ := rep.String(); s != message {
+				errors <- "expected " + message + ", got " + s
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errors)
+	for e := range errors {
+		t.Fatal(e)
+	}
+
+	rep, err := conn.Run(NewCommand("UNKNOWN"))
+	if err != nil || !rep.IsError() {
+		t.Fatal(err, rep)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err = conn.RunContext(ctx, NewCommand("SLOW")); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	rep, err = conn.Run(NewCommand("ECHO", "after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rep.String(); s != "after" {
+		t.Fatal(s)
+	}
+
+	conn.Close()
+	if _, err = conn.Run(NewCommand("ECHO", "closed")); err != ErrNotConnected {
+		t.Fatal(err)
+	}
+}
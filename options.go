@@ -0,0 +1,294 @@
+package gore
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Options holds per-client settings used when dialing a redis server.
+// A nil *Options is valid and means default settings.
+type Options struct {
+	// Network to dial, "tcp" by default. Use "unix" to connect to a unix
+	// domain socket, with the socket path as the address.
+	Network string
+	// Dialer opens the network connection instead of dialing Network and
+	// the address when it is not nil. This allows tunnels or in-memory
+	// connections to be used. The same Dialer is used on reconnection.
+	Dialer func(ctx context.Context) (net.Conn, error)
+	// TLSConfig enables TLS when it is not nil. Certificates, RootCAs
+	// and ServerName are used as usual. If ServerName is empty, the host
+	// part of the address is used.
+	TLSConfig *tls.Config
+	// Username and Password are sent every time the connection is opened.
+	// Username is only needed for Redis 6 ACL users.
+	Username string
+	Password string
+	// CredentialsProvider, if set, is called every time the connection is
+	// opened to get the username and password, so rotated secrets are used on
+	// reconnection. It takes precedence over any other username and password.
+	CredentialsProvider func() (username, password string, err error)
+	// Database is selected every time the connection is opened
+	Database int
+	// ClientName is set with CLIENT SETNAME every time the connection is opened
+	ClientName string
+	// Protocol is the RESP version to use, 2 by default. With 3, HELLO 3
+	// is sent every time the connection is opened, and replies may have
+	// RESP3 types such as ReplyMap or ReplyDouble.
+	Protocol int
+	// ConnectTimeout limits the time to open the connection, including
+	// the handshake. Dial and DialWithOptions have no timeout by default,
+	// while pools and sentinels use Config.ConnectTimeout.
+	ConnectTimeout time.Duration
+	// KeepAlive is the TCP keepalive period of dialed connections. Zero means
+	// the default of net.Dialer, and a negative value disables keepalive.
+	// It is not used with a custom Dialer.
+	KeepAlive time.Duration
+	// HealthCheckInterval, if positive, is how long a connection can stay idle
+	// before it is checked with a PING in the background. A connection which
+	// does not answer within its read timeout is reconnected. Health checks
+	// are skipped for subscriptions, but must not be enabled for connections
+	// used with Send and Receive directly.
+	HealthCheckInterval time.Duration
+	// RequestTimeout limits the time to send a command and read its reply
+	RequestTimeout time.Duration
+	// ReadTimeout and WriteTimeout limit reading a reply and writing a
+	// command separately, instead of RequestTimeout
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// ReconnectTime is the wait before a failed connection is reconnected.
+	// The wait grows by ReconnectTime after each failed attempt, up to
+	// MaximumReconnectTime. They are ignored if ReconnectPolicy is set.
+	ReconnectTime        time.Duration
+	MaximumReconnectTime time.Duration
+	// ReconnectPolicy decides the wait between reconnection attempts, and
+	// when to give up.
+	ReconnectPolicy ReconnectPolicy
+	// EventListener receives connection events, such as disconnections and
+	// reconnections, of every connection using these options, and sentinel
+	// events. It is called synchronously, so it should return quickly.
+	EventListener func(*Event)
+	// GiveUpHandler is called when reconnection to address is given up
+	// by the ReconnectPolicy, with the error of the last attempt.
+	GiveUpHandler func(address string, err error)
+	// RetryInterval is the wait between retries of other background work,
+	// such as resubscribing channels or querying sentinel.
+	RetryInterval time.Duration
+	// PoolInitialSize and PoolMaximumSize are the default connection
+	// numbers of a Pool using these options, instead of the ones in Config.
+	PoolInitialSize int
+	PoolMaximumSize int
+	// PoolIdleTimeout, PoolMaxLifetime and PoolMinIdle are the default
+	// IdleTimeout, MaxLifetime and MinIdle of a Pool using these options.
+	PoolIdleTimeout time.Duration
+	PoolMaxLifetime time.Duration
+	PoolMinIdle     int
+	// PoolAcquireTimeout and PoolMaxWaiters are the default AcquireTimeout
+	// and MaxWaiters of a Pool using these options.
+	PoolAcquireTimeout time.Duration
+	PoolMaxWaiters     int
+	// PoolTestOnBorrow and PoolResetOnRelease are the default TestOnBorrow
+	// and ResetOnRelease of a Pool using these options.
+	PoolTestOnBorrow   time.Duration
+	PoolResetOnRelease bool
+	// PushHandler receives RESP3 push replies, for example invalidation
+	// messages, arriving on a connection which is not used by Subscriptions.
+	// Without a handler, push replies are returned like normal replies.
+	PushHandler func(*Reply)
+}
+
+// dial opens the underlying network connection to address
+func (o *Options) dial(ctx context.Context, address string) (net.Conn, error) {
+	var netConn net.Conn
+	var err error
+	if o != nil && o.Dialer != nil {
+		netConn, err = o.Dialer(ctx)
+	} else {
+		dialer := &net.Dialer{KeepAlive: o.keepAlive()}
+		netConn, err = dialer.DialContext(ctx, o.network(), address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o == nil || o.TLSConfig == nil {
+		return netConn, nil
+	}
+	config := o.TLSConfig
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(netConn, config)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// sentinelOptions returns the options used for sentinel servers when a Sentinel
+// has no SentinelOptions: the transport, timeout and reconnection settings of o,
+// without the settings of the monitored instances.
+func (o *Options) sentinelOptions() *Options {
+	if o == nil {
+		return nil
+	}
+	return &Options{
+		TLSConfig:            o.TLSConfig,
+		ConnectTimeout:       o.ConnectTimeout,
+		KeepAlive:            o.KeepAlive,
+		RequestTimeout:       o.RequestTimeout,
+		ReadTimeout:          o.ReadTimeout,
+		WriteTimeout:         o.WriteTimeout,
+		ReconnectTime:        o.ReconnectTime,
+		MaximumReconnectTime: o.MaximumReconnectTime,
+		ReconnectPolicy:      o.ReconnectPolicy,
+		EventListener:        o.EventListener,
+		GiveUpHandler:        o.GiveUpHandler,
+		RetryInterval:        o.RetryInterval,
+	}
+}
+
+func (o *Options) keepAlive() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.KeepAlive
+}
+
+func (o *Options) healthCheckInterval() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.HealthCheckInterval
+}
+
+func (o *Options) connectTimeout() time.Duration {
+	if o == nil || o.ConnectTimeout <= 0 {
+		return seconds(Config.ConnectTimeout)
+	}
+	return o.ConnectTimeout
+}
+
+func (o *Options) requestTimeout() time.Duration {
+	if o == nil || o.RequestTimeout <= 0 {
+		return seconds(Config.RequestTimeout)
+	}
+	return o.RequestTimeout
+}
+
+func (o *Options) reconnectTime() time.Duration {
+	if o == nil || o.ReconnectTime <= 0 {
+		return seconds(Config.ReconnectTime)
+	}
+	return o.ReconnectTime
+}
+
+func (o *Options) maximumReconnectTime() time.Duration {
+	if o == nil || o.MaximumReconnectTime <= 0 {
+		return seconds(Config.MaximumReconnectTime)
+	}
+	return o.MaximumReconnectTime
+}
+
+func (o *Options) reconnectPolicy() ReconnectPolicy {
+	if o == nil || o.ReconnectPolicy == nil {
+		return &LinearBackoff{
+			Step:    o.reconnectTime(),
+			Maximum: o.maximumReconnectTime(),
+		}
+	}
+	return o.ReconnectPolicy
+}
+
+func (o *Options) giveUp(address string, err error) {
+	if o != nil && o.GiveUpHandler != nil {
+		o.GiveUpHandler(address, err)
+	}
+}
+
+func (o *Options) retryInterval() time.Duration {
+	if o == nil || o.RetryInterval <= 0 {
+		return seconds(Config.RetryInterval)
+	}
+	return o.RetryInterval
+}
+
+func (o *Options) protocol() int {
+	if o == nil || o.Protocol == 0 {
+		return 2
+	}
+	return o.Protocol
+}
+
+func (o *Options) network() string {
+	if o == nil || o.Network == "" {
+		return "tcp"
+	}
+	return o.Network
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+func (o *Options) poolInitialSize() int {
+	if o == nil || o.PoolInitialSize <= 0 {
+		return Config.PoolInitialSize
+	}
+	return o.PoolInitialSize
+}
+
+func (o *Options) poolMaximumSize() int {
+	if o == nil || o.PoolMaximumSize <= 0 {
+		return Config.PoolMaximumSize
+	}
+	return o.PoolMaximumSize
+}
+
+func (o *Options) poolIdleTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.PoolIdleTimeout
+}
+
+func (o *Options) poolMaxLifetime() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.PoolMaxLifetime
+}
+
+func (o *Options) poolMinIdle() int {
+	if o == nil {
+		return 0
+	}
+	return o.PoolMinIdle
+}
+
+func (o *Options) poolAcquireTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.PoolAcquireTimeout
+}
+
+func (o *Options) poolMaxWaiters() int {
+	if o == nil {
+		return 0
+	}
+	return o.PoolMaxWaiters
+}
+
+func (o *Options) poolTestOnBorrow() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.PoolTestOnBorrow
+}
+
+func (o *Options) poolResetOnRelease() bool {
+	return o != nil && o.PoolResetOnRelease
+}
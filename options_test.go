@@ -0,0 +1,305 @@
+package gore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gore test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestTLS(t *testing.T) {
+	cert, roots := newTestCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startFakeServer(l, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	options := &Options{TLSConfig: &tls.Config{RootCAs: roots}}
+	conn, err := DialWithOptions(s.Addr(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, ok := conn.tcpConn.(*tls.Conn); !ok {
+		t.Fatal("not a TLS connection")
+	}
+	rep, err := NewCommand("PING").Run(conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+
+	pool := &Pool{
+		InitialConn: 2,
+		MaximumConn: 2,
+		Options:     options,
+	}
+	if err = pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err = pool.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err, conn)
+	}
+	defer pool.Release(conn)
+	rep, err = NewCommand("PING").Run(conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+
+	if _, err = DialWithOptions(s.Addr(), &Options{TLSConfig: &tls.Config{}}); err == nil {
+		t.Fatal("untrusted certificate should be rejected")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "redis.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := startFakeServer(l, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		Options:     &Options{Network: "unix"},
+	}
+	if err = pool.Dial(path); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, err := pool.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err, conn)
+	}
+	defer pool.Release(conn)
+	rep, err := NewCommand("PING").Run(conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	s := &fakeServer{
+		handler: func(args []string) string {
+			return "+PONG\r\n"
+		},
+	}
+	dials := make(chan bool, 2)
+	options := &Options{
+		Dialer: func(ctx context.Context) (net.Conn, error) {
+			dials <- true
+			client, server := net.Pipe()
+			go s.handle(server)
+			return client, nil
+		},
+	}
+	conn, err := DialWithOptions("pipe", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rep, err := NewCommand("PING").Run(conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	<-dials
+	select {
+	case <-dials:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect did not use the dialer")
+	}
+	rep, err = NewCommand("PING").Run(conn)
+	if err != nil || rep != pongReply {
+		t.Fatal(err, rep)
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "HELLO":
+			if args[1] != "3" {
+				return "-NOPROTO unsupported protocol version\r\n"
+			}
+			return "%1\r\n+proto\r\n:3\r\n"
+		case "HGETALL":
+			return "%1\r\n+field\r\n+value\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	conn, err := DialWithOptions(s.Addr(), &Options{Protocol: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rep, err := NewCommand("HGETALL", "key").Run(conn)
+	if err != nil || !rep.IsMap() {
+		t.Fatal(err, rep)
+	}
+	m, err := rep.Map()
+	if err != nil || m["field"] != "value" {
+		t.Fatal(err, m)
+	}
+	if _, err = DialWithOptions(s.Addr(), &Options{Protocol: 4}); err != ErrProtocol {
+		t.Fatal(err)
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	var options *Options
+	if options.requestTimeout() != seconds(Config.RequestTimeout) || options.retryInterval() != seconds(Config.RetryInterval) {
+		t.Fatal("nil options should use Config")
+	}
+	options = &Options{
+		RequestTimeout:  time.Second,
+		PoolInitialSize: 1,
+		PoolMaximumSize: 3,
+	}
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+	pool := NewPool(options)
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if pool.InitialConn != 1 || pool.MaximumConn != 3 || pool.RequestTimeout != time.Second {
+		t.Fatal(pool.InitialConn, pool.MaximumConn, pool.RequestTimeout)
+	}
+	conn, err := pool.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err, conn)
+	}
+	defer pool.Release(conn)
+	if conn.RequestTimeout != time.Second {
+		t.Fatal(conn.RequestTimeout)
+	}
+	if other := NewPool(nil); other.Options != nil {
+		t.Fatal("pools should not share options")
+	}
+	if options.connectTimeout() != seconds(Config.ConnectTimeout) || options.retryInterval() != seconds(Config.RetryInterval) ||
+		options.poolMaximumSize() != 3 || options.protocol() != 2 || options.network() != "tcp" {
+		t.Fatal("unset options should use defaults")
+	}
+	options = nil
+	if options.connectTimeout() != 5*time.Second || options.requestTimeout() != 10*time.Second ||
+		options.reconnectTime() != 2*time.Second || options.maximumReconnectTime() != 30*time.Second ||
+		options.poolInitialSize() != 5 || options.poolMaximumSize() != 10 || options.poolIdleTimeout() != 0 ||
+		options.poolAcquireTimeout() != 0 || options.poolResetOnRelease() {
+		t.Fatal("bad default values")
+	}
+}
+
+func TestSentinelOptions(t *testing.T) {
+	options := &Options{
+		Password:       "instance",
+		Database:       3,
+		ConnectTimeout: time.Second,
+		Dialer: func(ctx context.Context) (net.Conn, error) {
+			return nil, ErrNotConnected
+		},
+	}
+	if o := options.sentinelOptions(); o.Password != "" || o.Database != 0 || o.Dialer != nil || o.ConnectTimeout != time.Second {
+		t.Fatal("sentinel options should only keep transport settings", o)
+	}
+
+	auth := make(chan string, 10)
+	server := newFakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "AUTH":
+			auth <- args[1]
+			return "+OK\r\n"
+		case "SUBSCRIBE":
+			rep := ""
+			for i, channel := range args[1:] {
+				rep += "*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(channel)) + "\r\n" + channel + "\r\n:" + strconv.Itoa(i+1) + "\r\n"
+			}
+			return rep
+		}
+		return "-ERR unknown command\r\n"
+	})
+	defer server.Close()
+
+	s := NewSentinelWithOptions(options)
+	s.AddServer(server.Addr())
+	if err := s.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if len(auth) != 0 {
+		t.Fatal("instance credentials were sent to sentinel", <-auth)
+	}
+
+	s = NewSentinelWithOptions(options)
+	s.SentinelOptions = &Options{Password: "sentinel"}
+	s.AddServer(server.Addr())
+	if err := s.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if password := <-auth; password != "sentinel" {
+		t.Fatal("SentinelOptions were not used", password)
+	}
+}
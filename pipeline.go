@@ -1,6 +1,7 @@
 package gore
 
 import (
+	"context"
 	"time"
 )
 
@@ -28,9 +29,18 @@ func (p *Pipeline) Reset() {
 
 // Run sends the pipeline and returns a slice of Reply
 func (p *Pipeline) Run(conn *Conn) (r []*Reply, err error) {
+	return p.RunContext(context.Background(), conn)
+}
+
+// RunContext sends the pipeline and returns a slice of Reply. The pipeline
+// is aborted when ctx is cancelled, and the connection is then reconnected.
+func (p *Pipeline) RunContext(ctx context.Context, conn *Conn) (r []*Reply, err error) {
 	if len(p.commands) == 0 {
 		return nil, nil
 	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	if conn.state != connStateConnected {
 		return nil, ErrNotConnected
 	}
@@ -38,30 +48,31 @@ func (p *Pipeline) Run(conn *Conn) (r []*Reply, err error) {
 	defer func() {
 		conn.Unlock()
 		if err != nil {
-			conn.fail()
+			conn.fail(err)
 		}
 	}()
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetWriteDeadline(time.Now().Add(conn.RequestTimeout * time.Duration(len(p.commands)/10+1)))
-	}
+	stop := conn.watchContext(ctx)
+	defer stop()
+	conn.tcpConn.SetWriteDeadline(deadline(ctx, conn.writeTimeout()*time.Duration(len(p.commands)/10+1)))
 	for _, cmd := range p.commands {
 		err = cmd.writeCommand(conn)
 		if err != nil {
-			return nil, ErrWrite
+			return nil, contextError(ctx, ErrWrite)
 		}
 	}
 	err = conn.wb.Flush()
 	if err != nil {
-		return nil, ErrWrite
+		return nil, contextError(ctx, ErrWrite)
 	}
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetReadDeadline(time.Now().Add(conn.RequestTimeout * time.Duration(len(p.commands)/10+1)))
+	conn.tcpConn.SetReadDeadline(deadline(ctx, readTimeout(conn, p.commands)))
+	if err = ctx.Err(); err != nil {
+		return nil, err
 	}
 	replies := make([]*Reply, len(p.commands))
 	for i := range replies {
 		rep, err := readReply(conn)
 		if err != nil {
-			return nil, err
+			return nil, contextError(ctx, err)
 		}
 		replies[i] = rep
 	}
@@ -2,6 +2,7 @@ package gore
 
 import (
 	"container/list"
+	"context"
 	"sync"
 	"time"
 )
@@ -16,8 +17,37 @@ type Pool struct {
 	InitialConn int
 	// Maximum number of connection to open
 	MaximumConn int
+	// Username to send with the password, for Redis 6 ACL users
+	Username string
 	// Password to send after connection is opened
 	Password string
+	// Options used to open each connection
+	Options *Options
+	// IdleTimeout closes connections which stay unused in the pool longer
+	// than this, down to MinIdle connections. Zero means never.
+	IdleTimeout time.Duration
+	// MaxLifetime closes connections opened longer than this, when they are
+	// idle or released. Zero means never.
+	MaxLifetime time.Duration
+	// MinIdle is the number of idle connections the pool tries to keep
+	// open, dialing new ones in the background when needed.
+	MinIdle int
+	// AcquireTimeout limits the time Acquire waits for a connection to be
+	// released when all connections are in use. ErrPoolTimeout is returned
+	// then. Zero means no limit.
+	AcquireTimeout time.Duration
+	// MaxWaiters limits the number of goroutines waiting in Acquire at the
+	// same time. More goroutines fail fast with ErrPoolExhausted. Zero
+	// means no limit.
+	MaxWaiters int
+	// TestOnBorrow, if positive, makes Acquire check connections which stayed
+	// idle in the pool longer than this with a PING. A connection failing
+	// the check is closed instead of being returned.
+	TestOnBorrow time.Duration
+	// ResetOnRelease makes Release discard any open transaction or watched
+	// keys, and select the database of Options again, so the next borrower
+	// gets a clean session. Subscribed connections are closed.
+	ResetOnRelease bool
 
 	l                    *list.List
 	currentNumberOfConn  int
@@ -27,6 +57,46 @@ type Pool struct {
 	address              string
 	closed               bool
 	sentinel             bool
+	stopReaper           chan struct{}
+	dialingNumberOfConn  int
+	stats                PoolStats
+	waiters              int
+}
+
+// PoolStats is a snapshot of the state and counters of a pool
+type PoolStats struct {
+	// TotalConns is the number of open connections, idle, in use or unusable
+	TotalConns int
+	// IdleConns is the number of connections ready to be acquired
+	IdleConns int
+	// InUseConns is the number of connections acquired and not released yet
+	InUseConns int
+	// UnusableConns is the number of released connections waiting to be reconnected
+	UnusableConns int
+	// Hits is the number of acquisitions served by an idle connection,
+	// and Misses the number of acquisitions which had to dial or wait
+	Hits   uint64
+	Misses uint64
+	// WaitCount is the number of acquisitions which waited for a connection
+	// to be released, and WaitDuration the total time they waited
+	WaitCount    uint64
+	WaitDuration time.Duration
+	// Dials and DialFailures count the connections opened by the pool
+	Dials        uint64
+	DialFailures uint64
+	// Timeouts is the number of acquisitions aborted by their context
+	// or AcquireTimeout
+	Timeouts uint64
+	// IdleClosed and LifetimeClosed count the connections closed because of
+	// IdleTimeout and MaxLifetime
+	IdleClosed     uint64
+	LifetimeClosed uint64
+}
+
+// NewPool returns a pool using options to open connections. The pool sizes
+// and request timeout are taken from options.
+func NewPool(options *Options) *Pool {
+	return &Pool{Options: options}
 }
 
 // Dial initializes connection from the pool to redis server.
@@ -34,22 +104,50 @@ type Pool struct {
 // an error, and the application should fail accordingly.
 func (p *Pool) Dial(address string) error {
 	if p.RequestTimeout <= 0 {
-		p.RequestTimeout = 10 * time.Second
+		p.RequestTimeout = p.Options.requestTimeout()
 	}
 	if p.InitialConn <= 0 {
-		p.InitialConn = Config.PoolInitialSize
+		p.InitialConn = p.Options.poolInitialSize()
 	}
 	if p.MaximumConn <= 0 {
-		p.MaximumConn = Config.PoolMaximumSize
+		p.MaximumConn = p.Options.poolMaximumSize()
 	}
 	if p.MaximumConn < p.InitialConn {
 		p.MaximumConn = p.InitialConn
 	}
+	if p.IdleTimeout <= 0 {
+		p.IdleTimeout = p.Options.poolIdleTimeout()
+	}
+	if p.MaxLifetime <= 0 {
+		p.MaxLifetime = p.Options.poolMaxLifetime()
+	}
+	if p.MinIdle <= 0 {
+		p.MinIdle = p.Options.poolMinIdle()
+	}
+	if p.MinIdle > p.MaximumConn {
+		p.MinIdle = p.MaximumConn
+	}
+	if p.AcquireTimeout <= 0 {
+		p.AcquireTimeout = p.Options.poolAcquireTimeout()
+	}
+	if p.MaxWaiters <= 0 {
+		p.MaxWaiters = p.Options.poolMaxWaiters()
+	}
+	if p.TestOnBorrow <= 0 {
+		p.TestOnBorrow = p.Options.poolTestOnBorrow()
+	}
+	if !p.ResetOnRelease {
+		p.ResetOnRelease = p.Options.poolResetOnRelease()
+	}
 	p.l = list.New()
 	p.mutex = &sync.Mutex{}
 	p.cond = sync.NewCond(p.mutex)
 	p.address = address
-	return p.connect(0)
+	if err := p.connect(p.Options.connectTimeout()); err != nil {
+		return err
+	}
+	p.startReaper()
+	return nil
 }
 
 // Close properly closes the pool
@@ -60,6 +158,10 @@ func (p *Pool) Close() {
 		return
 	}
 	p.closed = true
+	if p.stopReaper != nil {
+		close(p.stopReaper)
+		p.stopReaper = nil
+	}
 	for e := p.l.Front(); e != nil; e = e.Next() {
 		conn, _ := e.Value.(*Conn)
 		conn.Close()
@@ -82,39 +184,148 @@ func (p *Pool) GetAddress() string {
 	return p.address
 }
 
+// Stats returns a snapshot of the pool statistics
+func (p *Pool) Stats() PoolStats {
+	if p.mutex == nil {
+		return PoolStats{}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	stats := p.stats
+	// Connections dialed by the reaper are counted once opened
+	stats.TotalConns = p.currentNumberOfConn - p.dialingNumberOfConn
+	stats.IdleConns = p.l.Len()
+	stats.UnusableConns = p.unusableNumberOfConn
+	stats.InUseConns = stats.TotalConns - stats.IdleConns - stats.UnusableConns
+	if stats.InUseConns < 0 {
+		stats.InUseConns = 0
+	}
+	return stats
+}
+
 // Acquire returns a usable, exclusive connection for the goroutine.
 // If this function return a nil connection, application can check the
 // error to know whether there is really an error or it is because the pool was closed.
 // If the pool was closed, the returned error will also be nil.
 func (p *Pool) Acquire() (*Conn, error) {
+	return p.AcquireContext(context.Background())
+}
+
+// AcquireContext returns a usable, exclusive connection for the goroutine
+// like Acquire. If ctx is cancelled while waiting for a free connection,
+// the wait is aborted and the context error is returned.
+func (p *Pool) AcquireContext(ctx context.Context) (*Conn, error) {
+	// AcquireTimeout covers the connections which fail TestOnBorrow too
+	var deadline time.Time
+	if p.AcquireTimeout > 0 {
+		deadline = time.Now().Add(p.AcquireTimeout)
+	}
+	for {
+		conn, test, err := p.acquire(ctx, deadline)
+		if !test {
+			return conn, err
+		}
+		if conn.Ping() == nil {
+			return conn, nil
+		}
+		// The connection is reconnecting or broken. It is given up rather than
+		// released, which would make it look recently tested, and another one
+		// is taken or dialed.
+		conn.Close()
+		p.mutex.Lock()
+		if !p.closed {
+			p.currentNumberOfConn--
+			p.cond.Signal()
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// acquire takes a connection from the pool, waiting for one until deadline
+// if it is not zero, and returns whether it must be tested before use.
+func (p *Pool) acquire(ctx context.Context, deadline time.Time) (*Conn, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	waitCtx := ctx
+	stop := func() {}
+	defer func() {
+		stop()
+	}()
+	if p.l.Len() > 0 {
+		p.stats.Hits++
+	} else {
+		p.stats.Misses++
+	}
+	var waitStart time.Time
+	defer func() {
+		if !waitStart.IsZero() {
+			p.stats.WaitDuration += time.Since(waitStart)
+			p.waiters--
+		}
+	}()
 	for p.l.Len() == 0 && !p.closed {
 		if p.currentNumberOfConn < p.MaximumConn {
-			conn, err := DialTimeout(p.address, 5*time.Second)
+			conn, err := p.dial(ctx, p.Options.connectTimeout())
+			p.countDial(err)
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
-			p.l.PushBack(conn)
 			p.currentNumberOfConn++
+			p.putIdle(conn)
 			break
 		} else if p.currentNumberOfConn == p.unusableNumberOfConn {
 			// All available connections are disconnected. We fail fast here.
-			return nil, ErrNotConnected
+			return nil, false, ErrNotConnected
 		} else {
 			// Wait
+			if waitStart.IsZero() {
+				if p.MaxWaiters > 0 && p.waiters >= p.MaxWaiters {
+					return nil, false, ErrPoolExhausted
+				}
+				waitStart = time.Now()
+				p.stats.WaitCount++
+				p.waiters++
+				// The timeout and the context are only watched when waiting
+				cancel := context.CancelFunc(func() {})
+				if !deadline.IsZero() {
+					waitCtx, cancel = context.WithDeadline(ctx, deadline)
+				}
+				stopWatch := p.watchContext(waitCtx)
+				stop = func() {
+					stopWatch()
+					cancel()
+				}
+			}
 			p.cond.Wait()
 			if p.closed {
 				// The wait may be broken by a broadcast from close.
-				return nil, nil
+				return nil, false, nil
+			}
+			if p.l.Len() > 0 || p.currentNumberOfConn < p.MaximumConn {
+				// A connection is available, even if the context is done
+				continue
+			}
+			if err := waitCtx.Err(); err != nil {
+				// Or by a broadcast from the context watcher. This goroutine
+				// may have consumed the signal of a release, so pass it on.
+				p.cond.Signal()
+				p.stats.Timeouts++
+				if ctx.Err() == nil {
+					return nil, false, ErrPoolTimeout
+				}
+				return nil, false, ctx.Err()
 			}
 		}
 	}
 	if p.closed {
-		return nil, nil
+		return nil, false, nil
 	}
 	conn, _ := p.l.Remove(p.l.Front()).(*Conn)
-	return conn, nil
+	test := p.TestOnBorrow > 0 && time.Since(conn.idleSince) >= p.TestOnBorrow
+	return conn, test, nil
 }
 
 // Release pushs the connection back to the pool. The pool makes sure
@@ -132,6 +343,67 @@ func (p *Pool) Release(conn *Conn) {
 	go p.pushBack(conn)
 }
 
+// Do acquires a connection, runs the command on it and releases it.
+// ErrPoolClosed is returned if the pool was closed.
+func (p *Pool) Do(cmd *Command) (*Reply, error) {
+	return p.DoContext(context.Background(), cmd)
+}
+
+// DoContext runs the command like Do. ctx is used for both acquiring the
+// connection and running the command.
+func (p *Pool) DoContext(ctx context.Context, cmd *Command) (rep *Reply, err error) {
+	err = p.withConn(ctx, func(conn *Conn) error {
+		rep, err = cmd.RunContext(ctx, conn)
+		return err
+	})
+	return rep, err
+}
+
+// Pipeline acquires a connection, runs the pipeline on it and releases it.
+// ErrPoolClosed is returned if the pool was closed.
+func (p *Pool) Pipeline(pipeline *Pipeline) (replies []*Reply, err error) {
+	err = p.WithConn(func(conn *Conn) error {
+		replies, err = pipeline.Run(conn)
+		return err
+	})
+	return replies, err
+}
+
+// WithConn acquires a connection, calls fn with it and releases it, even if fn
+// panics. The error of fn is returned, or ErrPoolClosed if the pool was closed.
+func (p *Pool) WithConn(fn func(*Conn) error) error {
+	return p.withConn(context.Background(), fn)
+}
+
+// Transaction acquires a connection and calls fn with a new transaction on it.
+// fn can watch keys and add commands to the transaction, which is committed
+// when fn returns nil. If fn returns an error, watched keys are unwatched and
+// the error is returned.
+func (p *Pool) Transaction(fn func(*Transaction) error) (replies []*Reply, err error) {
+	err = p.WithConn(func(conn *Conn) error {
+		t := NewTransaction(conn)
+		if err := fn(t); err != nil {
+			NewCommand("UNWATCH").Run(conn)
+			return err
+		}
+		replies, err = t.Commit()
+		return err
+	})
+	return replies, err
+}
+
+func (p *Pool) withConn(ctx context.Context, fn func(*Conn) error) error {
+	conn, err := p.AcquireContext(ctx)
+	if err != nil {
+		return err
+	}
+	if conn == nil {
+		return ErrPoolClosed
+	}
+	defer p.Release(conn)
+	return fn(conn)
+}
+
 func (p *Pool) connect(timeout time.Duration) (err error) {
 	p.mutex.Lock()
 	defer func() {
@@ -149,32 +421,200 @@ func (p *Pool) connect(timeout time.Duration) (err error) {
 		return nil
 	}
 	for i := 0; i < p.InitialConn; i++ {
-		conn, err := DialTimeout(p.address, timeout)
+		conn, err := p.dial(context.Background(), timeout)
+		p.countDial(err)
 		if err != nil {
 			return err
 		}
-		if p.Password != "" {
-			err = conn.Auth(p.Password)
-			if err != nil {
-				conn.Close()
-				return err
+		p.putIdle(conn)
+	}
+	return nil
+}
+
+// countDial counts a dial and its failure. Caller must hold the lock.
+func (p *Pool) countDial(err error) {
+	p.stats.Dials++
+	if err != nil {
+		p.stats.DialFailures++
+	}
+}
+
+// putIdle pushes a usable connection to the acquirable list.
+// Caller must hold the lock.
+func (p *Pool) putIdle(conn *Conn) {
+	conn.idleSince = time.Now()
+	p.l.PushBack(conn)
+}
+
+// expired returns true if conn has been opened for longer than MaxLifetime
+func (p *Pool) expired(conn *Conn, now time.Time) bool {
+	return p.MaxLifetime > 0 && now.Sub(conn.connectedAt) >= p.MaxLifetime
+}
+
+// startReaper starts the goroutine closing idle and expired connections,
+// and dialing connections up to MinIdle, if any of them is set.
+// Caller must not hold the lock.
+func (p *Pool) startReaper() {
+	if p.IdleTimeout <= 0 && p.MaxLifetime <= 0 && p.MinIdle <= 0 {
+		return
+	}
+	interval := p.Options.retryInterval()
+	if p.IdleTimeout > 0 && p.IdleTimeout/2 < interval {
+		interval = p.IdleTimeout / 2
+	}
+	if p.MaxLifetime > 0 && p.MaxLifetime/2 < interval {
+		interval = p.MaxLifetime / 2
+	}
+	if interval < minCheckInterval {
+		interval = minCheckInterval
+	}
+	p.mutex.Lock()
+	p.stopReaper = make(chan struct{})
+	stop := p.stopReaper
+	p.mutex.Unlock()
+	go p.reap(interval, stop)
+}
+
+func (p *Pool) reap(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			return
+		}
+		now := time.Now()
+		stale := []*Conn{}
+		for e := p.l.Front(); e != nil; {
+			next := e.Next()
+			conn, _ := e.Value.(*Conn)
+			expired := p.expired(conn, now)
+			idle := p.IdleTimeout > 0 && now.Sub(conn.idleSince) >= p.IdleTimeout && p.l.Len() > p.MinIdle
+			if expired || idle {
+				if expired {
+					p.stats.LifetimeClosed++
+				} else {
+					p.stats.IdleClosed++
+				}
+				p.l.Remove(e)
+				p.currentNumberOfConn--
+				stale = append(stale, conn)
 			}
+			e = next
+		}
+		missing := p.MinIdle - p.l.Len()
+		if missing > p.MaximumConn-p.currentNumberOfConn {
+			missing = p.MaximumConn - p.currentNumberOfConn
+		}
+		if missing > 0 {
+			// Reserve room for the new connections
+			p.currentNumberOfConn += missing
+			p.dialingNumberOfConn += missing
+		}
+		p.mutex.Unlock()
+		for _, conn := range stale {
+			conn.Close()
+		}
+		for i := 0; i < missing; i++ {
+			conn, err := p.dial(context.Background(), p.Options.connectTimeout())
+			p.mutex.Lock()
+			p.countDial(err)
+			p.dialingNumberOfConn--
+			if err != nil || p.closed {
+				p.currentNumberOfConn--
+				p.mutex.Unlock()
+				if conn != nil {
+					conn.Close()
+				}
+				continue
+			}
+			p.putIdle(conn)
+			p.cond.Signal()
+			p.mutex.Unlock()
 		}
-		conn.sentinel = p.sentinel
-		p.l.PushBack(conn)
 	}
-	return nil
+}
+
+// dial opens a new connection for the pool
+func (p *Pool) dial(ctx context.Context, timeout time.Duration) (*Conn, error) {
+	conn := newConn(p.Options)
+	conn.RequestTimeout = p.RequestTimeout
+	conn.sentinel = p.sentinel
+	if p.Password != "" {
+		conn.username = p.Username
+		conn.password = p.Password
+	}
+	if err := conn.dial(ctx, p.address, timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// watchContext wakes up all goroutines waiting in AcquireContext when
+// ctx is cancelled, so they can check their own context.
+func (p *Pool) watchContext(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.mutex.Lock()
+			p.cond.Broadcast()
+			p.mutex.Unlock()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
 }
 
 func (p *Pool) pushBack(conn *Conn) {
 	markedUnusable := false
 	for {
-		if conn.state == connStateConnected {
+		conn.mutex.Lock()
+		state, reconnected := conn.state, conn.reconnected
+		conn.mutex.Unlock()
+		if state == connStateConnected && p.ResetOnRelease {
+			if err := conn.resetSession(); err != nil {
+				if !conn.IsConnected() {
+					// The connection failed and is reconnecting
+					continue
+				}
+				// Give up this conn, so that a new one can be dialed
+				conn.Close()
+				p.mutex.Lock()
+				if markedUnusable {
+					p.unusableNumberOfConn--
+				}
+				p.currentNumberOfConn--
+				p.cond.Signal()
+				p.mutex.Unlock()
+				break
+			}
+		}
+		if state == connStateConnected {
 			p.mutex.Lock()
-			p.l.PushBack(conn)
 			if markedUnusable {
 				p.unusableNumberOfConn--
 			}
+			if p.expired(conn, time.Now()) {
+				// Give up this conn, so that a new one can be dialed
+				conn.Close()
+				p.currentNumberOfConn--
+				p.stats.LifetimeClosed++
+			} else {
+				p.putIdle(conn)
+			}
 			p.cond.Signal()
 			p.mutex.Unlock()
 			break
@@ -182,18 +622,38 @@ func (p *Pool) pushBack(conn *Conn) {
 			// Give up this conn
 			conn.Close()
 			break
-		} else if !markedUnusable {
-			markedUnusable = true
-			p.unusableNumberOfConn++
+		} else if state == connStateReconnecting {
+			if !markedUnusable {
+				markedUnusable = true
+				p.mutex.Lock()
+				p.unusableNumberOfConn++
+				p.mutex.Unlock()
+			}
+			// The connection reconnects with its own ReconnectPolicy
+			<-reconnected
+			continue
 		}
-		time.Sleep(2 * time.Second)
+		// The connection gave up reconnecting or was closed. Give up this
+		// conn, so that a new one can be dialed
+		conn.Close()
+		p.mutex.Lock()
+		if !p.closed {
+			if markedUnusable {
+				p.unusableNumberOfConn--
+			}
+			p.currentNumberOfConn--
+			p.cond.Signal()
+		}
+		p.mutex.Unlock()
+		break
 	}
 }
 
 func (p *Pool) sentinelGonnaGiveYouUp() {
-	for p.connect(time.Duration(Config.ConnectTimeout)*time.Second) != nil {
+	for p.connect(p.Options.connectTimeout()) != nil {
 	}
 	p.closed = false
+	p.startReaper()
 }
 
 func (p *Pool) sentinelGonnaLetYouDown() {
@@ -1,8 +1,10 @@
 package gore
 
 import (
+	"net"
 	"os"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -117,3 +119,439 @@ func TestPoolClose(t *testing.T) {
 		<-c
 	}
 }
+
+func TestPoolReaper(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 5,
+		IdleTimeout: 20 * time.Millisecond,
+		MinIdle:     2,
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conns := []*Conn{}
+	for i := 0; i < 4; i++ {
+		conn, err := pool.Acquire()
+		if err != nil || conn == nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		pool.Release(conn)
+	}
+	time.Sleep(100 * time.Millisecond)
+	pool.mutex.Lock()
+	idle, total := pool.l.Len(), pool.currentNumberOfConn
+	pool.mutex.Unlock()
+	if idle != 2 || total != 2 {
+		t.Fatal("idle connections were not closed", idle, total)
+	}
+	if stats := pool.Stats(); stats.IdleClosed != 2 || stats.Dials < 4 || stats.IdleConns != 2 {
+		t.Fatalf("%+v", stats)
+	}
+
+	lifetime := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		MaxLifetime: 20 * time.Millisecond,
+		MinIdle:     1,
+	}
+	if err := lifetime.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer lifetime.Close()
+	old, _ := lifetime.Acquire()
+	lifetime.Release(old)
+	time.Sleep(100 * time.Millisecond)
+	conn, err := lifetime.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err)
+	}
+	if conn == old || old.IsConnected() {
+		t.Fatal("expired connection was not replaced")
+	}
+	lifetime.Release(conn)
+
+	// A timeout shorter than the ticker resolution must not panic
+	short := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		IdleTimeout: time.Nanosecond,
+	}
+	if err := short.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer short.Close()
+	time.Sleep(5 * time.Millisecond)
+	if conn, err = short.Acquire(); err != nil || conn == nil {
+		t.Fatal(err)
+	}
+	short.Release(conn)
+}
+
+func TestPoolStats(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 2,
+	}
+	if stats := pool.Stats(); stats.TotalConns != 0 {
+		t.Fatalf("%+v", stats)
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	first, _ := pool.Acquire()
+	second, _ := pool.Acquire()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pool.Release(first)
+	}()
+	third, _ := pool.Acquire()
+	stats := pool.Stats()
+	if stats.TotalConns != 2 || stats.InUseConns != 2 || stats.IdleConns != 0 {
+		t.Fatalf("%+v", stats)
+	}
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Dials != 2 || stats.DialFailures != 0 {
+		t.Fatalf("%+v", stats)
+	}
+	if stats.WaitCount != 1 || stats.WaitDuration < 10*time.Millisecond {
+		t.Fatalf("%+v", stats)
+	}
+	pool.Release(second)
+	pool.Release(third)
+
+	// Connections being dialed by the reaper are not in use
+	slow := newFakeServer(t, func(args []string) string {
+		time.Sleep(50 * time.Millisecond)
+		return "+OK\r\n"
+	})
+	defer slow.Close()
+	reaped := &Pool{
+		InitialConn: 1,
+		MaximumConn: 2,
+		MinIdle:     2,
+		Options:     &Options{ClientName: "worker", RetryInterval: time.Millisecond},
+	}
+	if err := reaped.Dial(slow.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer reaped.Close()
+	time.Sleep(20 * time.Millisecond)
+	if stats := reaped.Stats(); stats.TotalConns != 1 || stats.InUseConns != 0 {
+		t.Fatalf("%+v", stats)
+	}
+}
+
+func TestPoolAcquireTimeout(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn:    1,
+		MaximumConn:    1,
+		AcquireTimeout: 20 * time.Millisecond,
+		MaxWaiters:     1,
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	conn, _ := pool.Acquire()
+	waiting := make(chan error)
+	go func() {
+		_, err := pool.Acquire()
+		waiting <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := pool.Acquire(); err != ErrPoolExhausted {
+		t.Fatal(err)
+	}
+	if err := <-waiting; err != ErrPoolTimeout {
+		t.Fatal(err)
+	}
+	if stats := pool.Stats(); stats.Timeouts != 1 {
+		t.Fatalf("%+v", stats)
+	}
+	pool.Release(conn)
+	conn, err := pool.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err)
+	}
+	pool.Release(conn)
+}
+
+func TestPoolTestOnBorrowAndReset(t *testing.T) {
+	commands := make(chan string, 100)
+	databases := make(chan string, 100)
+	s := newFakeServer(t, func(args []string) string {
+		commands <- args[0]
+		switch args[0] {
+		case "PING":
+			return "+PONG\r\n"
+		case "GET":
+			return "+QUEUED\r\n"
+		case "SELECT":
+			databases <- args[1]
+		case "SUBSCRIBE":
+			return "*3\r\n$9\r\nsubscribe\r\n$7\r\nchannel\r\n:1\r\n"
+		case "UNSUBSCRIBE":
+			return "*3\r\n$11\r\nunsubscribe\r\n$7\r\nchannel\r\n:0\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn:    1,
+		MaximumConn:    1,
+		TestOnBorrow:   10 * time.Millisecond,
+		ResetOnRelease: true,
+		Options:        &Options{Database: 2},
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if c := <-commands; c != "SELECT" {
+		t.Fatal(c)
+	}
+	time.Sleep(20 * time.Millisecond)
+	conn, _ := pool.Acquire()
+	if c := <-commands; c != "PING" {
+		t.Fatal("idle connection was not tested", c)
+	}
+	NewCommand("WATCH", "key").Run(conn)
+	NewCommand("SELECT", 5).Run(conn)
+	NewCommand("MULTI").Run(conn)
+	NewCommand("GET", "key").Run(conn)
+	pool.Release(conn)
+	for _, expected := range []string{"WATCH", "SELECT", "MULTI", "GET", "DISCARD", "SELECT"} {
+		if c := <-commands; c != expected {
+			t.Fatal(expected, c)
+		}
+	}
+	conn, _ = pool.Acquire()
+	NewCommand("GET", "key").Run(conn)
+	if c := <-commands; c != "GET" {
+		t.Fatal("recently used connection was tested", c)
+	}
+	// The database chosen with Select is reverted too
+	conn.Select(7)
+	pool.Release(conn)
+	for _, expected := range []string{"2", "5", "2", "7", "2"} {
+		if db := <-databases; db != expected {
+			t.Fatal(expected, db)
+		}
+	}
+	conn, _ = pool.Acquire()
+	defer pool.Release(conn)
+	conn.Lock()
+	database := conn.database
+	conn.Unlock()
+	if database != 2 {
+		t.Fatal("database was not restored", database)
+	}
+
+	subscribed, _ := Dial(s.Addr())
+	defer subscribed.Close()
+	NewCommand("SUBSCRIBE", "channel").Send(subscribed)
+	Receive(subscribed)
+	if err := subscribed.resetSession(); err != ErrSubscribed {
+		t.Fatal(err)
+	}
+	NewCommand("UNSUBSCRIBE", "channel").Send(subscribed)
+	Receive(subscribed)
+	if err := subscribed.resetSession(); err != nil {
+		t.Fatal("connection is still subscribed", err)
+	}
+}
+
+func TestPoolTestOnBorrowFailure(t *testing.T) {
+	loading := true
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "PING" && loading {
+			loading = false
+			return "-LOADING Redis is loading the dataset in memory\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn:  1,
+		MaximumConn:  1,
+		TestOnBorrow: 10 * time.Millisecond,
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	time.Sleep(20 * time.Millisecond)
+	// The connection failing the test is closed, and a new one is dialed
+	conn, err := pool.Acquire()
+	if err != nil || conn == nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(conn)
+	if stats := pool.Stats(); stats.Dials != 2 || stats.TotalConns != 1 {
+		t.Fatal("connection failing the test was not given up", stats)
+	}
+}
+
+func TestPoolHelpers(t *testing.T) {
+	commands := make(chan string, 100)
+	s := newFakeServer(t, func(args []string) string {
+		commands <- args[0]
+		switch args[0] {
+		case "PING":
+			return "+PONG\r\n"
+		case "SET":
+			return "+QUEUED\r\n"
+		case "EXEC":
+			return "*1\r\n+OK\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer s.Close()
+
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+	}
+	if err := pool.Dial(s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if rep, err := pool.Do(NewCommand("PING")); err != nil || rep != pongReply {
+		t.Fatal(rep, err)
+	}
+	p := NewPipeline()
+	p.Add(NewCommand("PING"), NewCommand("PING"))
+	if replies, err := pool.Pipeline(p); err != nil || len(replies) != 2 {
+		t.Fatal(replies, err)
+	}
+	if err := pool.WithConn(func(conn *Conn) error {
+		return ErrNil
+	}); err != ErrNil {
+		t.Fatal(err)
+	}
+	replies, err := pool.Transaction(func(t *Transaction) error {
+		t.Add(NewCommand("SET", "key", "value"))
+		return nil
+	})
+	if err != nil || len(replies) != 1 || !replies[0].IsOk() {
+		t.Fatal(replies, err)
+	}
+	// PING, PING, PING, MULTI, SET, EXEC
+	for i := 0; i < 6; i++ {
+		<-commands
+	}
+	if _, err = pool.Transaction(func(t *Transaction) error {
+		t.Watch("key")
+		return ErrKeyChanged
+	}); err != ErrKeyChanged {
+		t.Fatal(err)
+	}
+	if c := <-commands; c != "WATCH" {
+		t.Fatal(c)
+	}
+	if c := <-commands; c != "UNWATCH" {
+		t.Fatal(c)
+	}
+	pool.Close()
+	if _, err = pool.Do(NewCommand("PING")); err != ErrPoolClosed {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	handler := func(args []string) string {
+		return "+PONG\r\n"
+	}
+	s := newFakeServer(t, handler)
+	address := s.Addr()
+	givenUp := make(chan bool, 1)
+	pool := &Pool{
+		InitialConn: 1,
+		MaximumConn: 1,
+		Options: &Options{
+			ReconnectPolicy: &LinearBackoff{Step: 20 * time.Millisecond, MaxAttempts: 10},
+			GiveUpHandler: func(address string, err error) {
+				givenUp <- true
+			},
+		},
+	}
+	if err := pool.Dial(address); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The pool waits for the connection to reconnect
+	conn, _ := pool.Acquire()
+	s.Close()
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	pool.Release(conn)
+	time.Sleep(30 * time.Millisecond)
+	if stats := pool.Stats(); stats.UnusableConns != 1 {
+		t.Fatalf("%+v", stats)
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = startFakeServer(l, handler)
+	for i := 0; pool.Stats().IdleConns != 1; i++ {
+		if i == 100 {
+			t.Fatalf("%+v", pool.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, err = pool.Acquire()
+	if err != nil || conn == nil || !conn.IsConnected() {
+		t.Fatal(err, conn)
+	}
+
+	// The pool gives up the connection when the connection gives up
+	pool.Options.ReconnectPolicy = &LinearBackoff{Step: time.Millisecond, MaxAttempts: 2}
+	s.Close()
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	pool.Release(conn)
+	select {
+	case <-givenUp:
+	case <-time.After(time.Second):
+		t.Fatal("reconnection was not given up")
+	}
+	for i := 0; pool.Stats().TotalConns != 0; i++ {
+		if i == 100 {
+			t.Fatalf("%+v", pool.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := pool.Stats(); stats.UnusableConns != 0 {
+		t.Fatalf("%+v", stats)
+	}
+	if _, err = pool.Acquire(); err == nil || err == ErrNotConnected {
+		t.Fatal("a new connection should be dialed", err)
+	}
+}
@@ -50,6 +50,9 @@ func NewSubscriptions(conn *Conn) *Subscriptions {
 		readyChannel:   make(chan bool, 1),
 		throwError:     false,
 	}
+	conn.Lock()
+	conn.subscribed = true
+	conn.Unlock()
 	go s.receive()
 	return s
 }
@@ -122,7 +125,7 @@ func (s *Subscriptions) receive() {
 			}
 		}
 		for {
-			rep, err := readReply(s.conn)
+			rep, err := parseReply(s.conn)
 			if err != nil {
 				if s.throwError {
 					s.messageChannel <- nil
@@ -132,7 +135,7 @@ func (s *Subscriptions) receive() {
 				go s.resubscribe()
 				break
 			}
-			if !rep.IsArray() {
+			if !rep.IsArray() && !rep.IsPush() {
 				continue
 			}
 			replies, _ := rep.Array()
@@ -206,7 +209,7 @@ func (s *Subscriptions) resubscribe() {
 	defer s.lock.Unlock()
 	for {
 		if s.conn.state != connStateConnected {
-			time.Sleep(2 * time.Second)
+			time.Sleep(s.conn.options.retryInterval())
 			continue
 		}
 		channels := []string{}
@@ -0,0 +1,71 @@
+package gore
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy decides how long to wait between reconnection attempts
+// of connections, pools and sentinels.
+type ReconnectPolicy interface {
+	// Backoff returns the wait before the next attempt, after a number of
+	// consecutive failed attempts starting at 1. Returning false gives up.
+	Backoff(failures int) (time.Duration, bool)
+}
+
+// LinearBackoff waits Step after the first failure, and Step longer after
+// each following failure, up to Maximum. This is the default policy.
+type LinearBackoff struct {
+	Step    time.Duration
+	Maximum time.Duration
+	// MaxAttempts gives up after this number of failures. Zero means never.
+	MaxAttempts int
+}
+
+// Backoff implements ReconnectPolicy
+func (b *LinearBackoff) Backoff(failures int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && failures >= b.MaxAttempts {
+		return 0, false
+	}
+	delay := b.Step * time.Duration(failures)
+	if b.Maximum > 0 && delay > b.Maximum {
+		delay = b.Maximum
+	}
+	return delay, true
+}
+
+// ExponentialBackoff waits Initial after the first failure, multiplying the
+// wait by Multiplier (2 if not set) after each following failure, up to Maximum.
+// A Multiplier of 1 keeps the same wait, and a smaller one shortens it.
+// Jitter, between 0 and 1, randomly shortens each wait by up to this fraction so
+// that many clients do not reconnect at the same time.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Maximum    time.Duration
+	Multiplier float64
+	Jitter     float64
+	// MaxAttempts gives up after this number of failures. Zero means never.
+	MaxAttempts int
+}
+
+// Backoff implements ReconnectPolicy
+func (b *ExponentialBackoff) Backoff(failures int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && failures >= b.MaxAttempts {
+		return 0, false
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < failures && (b.Maximum <= 0 || delay < float64(b.Maximum)); i++ {
+		delay *= multiplier
+	}
+	if b.Maximum > 0 && delay > float64(b.Maximum) {
+		delay = float64(b.Maximum)
+	}
+	if b.Jitter > 0 {
+		delay -= delay * b.Jitter * rand.Float64()
+	}
+	return time.Duration(delay), true
+}
@@ -0,0 +1,81 @@
+package gore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinearBackoff(t *testing.T) {
+	b := &LinearBackoff{Step: 2 * time.Second, Maximum: 5 * time.Second, MaxAttempts: 4}
+	for failures, expected := range []time.Duration{0, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if failures == 0 {
+			continue
+		}
+		if d, ok := b.Backoff(failures); !ok || d != expected {
+			t.Fatal(failures, d, ok)
+		}
+	}
+	if _, ok := b.Backoff(4); ok {
+		t.Fatal("should give up")
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{Initial: 100 * time.Millisecond, Maximum: time.Second}
+	for failures, expected := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if failures == 0 {
+			continue
+		}
+		if d, ok := b.Backoff(failures); !ok || d != expected {
+			t.Fatal(failures, d, ok)
+		}
+	}
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d, ok := b.Backoff(10); !ok || d < 500*time.Millisecond || d > time.Second {
+			t.Fatal(d, ok)
+		}
+	}
+	// An explicit multiplier is kept, even if not above 1
+	b = &ExponentialBackoff{Initial: 100 * time.Millisecond, Multiplier: 0.5}
+	if d, ok := b.Backoff(3); !ok || d != 25*time.Millisecond {
+		t.Fatal(d, ok)
+	}
+	b.Multiplier = 1
+	if d, ok := b.Backoff(5); !ok || d != 100*time.Millisecond {
+		t.Fatal(d, ok)
+	}
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	givenUp := make(chan string, 1)
+	conn, err := DialWithOptions(s.Addr(), &Options{
+		ReconnectPolicy: &ExponentialBackoff{Initial: time.Millisecond, MaxAttempts: 3},
+		GiveUpHandler: func(address string, err error) {
+			givenUp <- address
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s.Close()
+	conn.Lock()
+	conn.state = connStateNotConnected
+	conn.Unlock()
+	conn.fail(ErrRead)
+	select {
+	case address := <-givenUp:
+		if address != s.Addr() {
+			t.Fatal(address)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnection was not given up")
+	}
+	if _, err = NewCommand("PING").Run(conn); err != ErrNotConnected {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,10 @@
 package gore
 
 import (
+	"context"
 	"io"
+	"math/big"
 	"strconv"
-	"time"
 )
 
 // Reply type, similar to Hiredis
@@ -14,6 +15,15 @@ const (
 	ReplyNil     = 4
 	ReplyStatus  = 5
 	ReplyError   = 6
+	// RESP3 reply types. Map, set and push replies behave like arrays,
+	// with maps holding keys and values one after another.
+	ReplyMap       = 7
+	ReplySet       = 8
+	ReplyDouble    = 9
+	ReplyBool      = 10
+	ReplyBigNumber = 11
+	ReplyVerbatim  = 12
+	ReplyPush      = 13
 )
 
 // Pair holds a pair of value, such as reply from HGETALL or ZRANGE [WITHSCORES]
@@ -26,8 +36,10 @@ type Pair struct {
 type Reply struct {
 	replyType    int
 	integerValue int64
+	doubleValue  float64
 	stringValue  []byte
 	arrayValue   []*Reply
+	attributes   *Reply
 }
 
 // Type returns reply type
@@ -37,24 +49,26 @@ func (r *Reply) Type() int {
 
 // String returns string value of a reply
 func (r *Reply) String() (string, error) {
-	if r.Type() == ReplyNil {
-		return "", ErrNil
-	}
-	if r.Type() != ReplyString && r.Type() != ReplyStatus {
-		return "", ErrType
+	b, err := r.Bytes()
+	if err != nil {
+		return "", err
 	}
-	return string(r.stringValue), nil
+	return string(b), nil
 }
 
-// Bytes returns string value of a reply as byte array
+// Bytes returns string value of a reply as byte array.
+// Verbatim strings are returned without their format prefix.
 func (r *Reply) Bytes() ([]byte, error) {
-	if r.Type() == ReplyNil {
+	switch r.Type() {
+	case ReplyNil:
 		return nil, ErrNil
-	}
-	if r.Type() != ReplyString && r.Type() != ReplyStatus {
+	case ReplyString, ReplyStatus, ReplyDouble, ReplyBigNumber:
+		return r.stringValue, nil
+	case ReplyVerbatim:
+		return r.stringValue[4:], nil
+	default:
 		return nil, ErrType
 	}
-	return r.stringValue, nil
 }
 
 // Int returns integer value (for example from INCR) or convert string value to integer if possible
@@ -73,8 +87,11 @@ func (r *Reply) Int() (int64, error) {
 	return x, nil
 }
 
-// Float parses string value to float64
+// Float returns value of a double reply, or parses string value to float64
 func (r *Reply) Float() (float64, error) {
+	if r.Type() == ReplyDouble {
+		return r.doubleValue, nil
+	}
 	s, err := r.String()
 	if err != nil {
 		return 0, err
@@ -87,6 +104,8 @@ func (r *Reply) Float() (float64, error) {
 // Other values will cause ErrConvert
 func (r *Reply) Bool() (bool, error) {
 	switch r.Type() {
+	case ReplyBool:
+		return r.integerValue == 1, nil
 	case ReplyString:
 		s, _ := r.String()
 		if s == "1" || s == "true" {
@@ -115,17 +134,86 @@ func (r *Reply) Integer() (int64, error) {
 	return r.Int()
 }
 
-// Array returns array value of a reply
+// Array returns array value of a reply. Set and push replies are returned
+// as arrays, and map replies as arrays of keys and values one after another.
 func (r *Reply) Array() ([]*Reply, error) {
 	if r.Type() == ReplyNil {
 		return nil, ErrNil
 	}
-	if r.Type() != ReplyArray {
+	if !r.isAggregate() {
 		return nil, ErrType
 	}
 	return r.arrayValue, nil
 }
 
+// Double returns value of a RESP3 double reply
+func (r *Reply) Double() (float64, error) {
+	if r.Type() == ReplyNil {
+		return 0, ErrNil
+	}
+	if r.Type() != ReplyDouble {
+		return 0, ErrType
+	}
+	return r.doubleValue, nil
+}
+
+// BigInt returns value of a RESP3 big number reply. Integer replies and
+// string replies holding a number are converted too.
+func (r *Reply) BigInt() (*big.Int, error) {
+	if r.Type() == ReplyInteger {
+		return big.NewInt(r.integerValue), nil
+	}
+	s, err := r.String()
+	if err != nil {
+		return nil, err
+	}
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, ErrConvert
+	}
+	return x, nil
+}
+
+// Format returns format of a RESP3 verbatim string reply, for example "txt" or "mkd"
+func (r *Reply) Format() (string, error) {
+	if r.Type() != ReplyVerbatim {
+		return "", ErrType
+	}
+	return string(r.stringValue[:3]), nil
+}
+
+// MapValue returns value of a RESP3 map reply, keyed by the string value of each key.
+// Array replies of keys and values one after another (HGETALL in RESP2) are also accepted.
+func (r *Reply) MapValue() (map[string]*Reply, error) {
+	if r.Type() == ReplyNil {
+		return nil, ErrNil
+	}
+	if r.Type() != ReplyMap && r.Type() != ReplyArray {
+		return nil, ErrType
+	}
+	if len(r.arrayValue)%2 != 0 {
+		return nil, ErrType
+	}
+	m := make(map[string]*Reply, len(r.arrayValue)/2)
+	for i := 0; i < len(r.arrayValue)/2; i++ {
+		key, err := r.arrayValue[2*i].String()
+		if err != nil {
+			if r.arrayValue[2*i].Type() != ReplyInteger {
+				return nil, ErrType
+			}
+			key = strconv.FormatInt(r.arrayValue[2*i].integerValue, 10)
+		}
+		m[key] = r.arrayValue[2*i+1]
+	}
+	return m, nil
+}
+
+// Attributes returns the RESP3 attributes sent along with the reply as a map reply,
+// or nil if there are none.
+func (r *Reply) Attributes() *Reply {
+	return r.attributes
+}
+
 // FixInt returns a fixed size int64
 func (r *Reply) FixInt() (int64, error) {
 	if r.Type() == ReplyNil {
@@ -154,7 +242,7 @@ func (r *Reply) Slice(s interface{}) error {
 	if r.Type() == ReplyNil {
 		return ErrNil
 	}
-	if r.Type() != ReplyArray {
+	if !r.isAggregate() {
 		return ErrType
 	}
 	if len(r.arrayValue) == 0 {
@@ -266,12 +354,12 @@ func (r *Reply) Slice(s interface{}) error {
 
 // Map converts the reply into a map[string]string.
 // It will return error unless the reply is an array reply from HGETALL,
-// or SENTINEL master
+// or SENTINEL master, or a RESP3 map reply
 func (r *Reply) Map() (map[string]string, error) {
 	if r.IsNil() {
 		return nil, ErrNil
 	}
-	if !r.IsArray() {
+	if !r.IsArray() && !r.IsMap() {
 		return nil, ErrType
 	}
 	if len(r.arrayValue)%2 != 0 {
@@ -312,7 +400,7 @@ func (r *Reply) IsStatus() bool {
 
 // IsOk checks if reply is a status reply with "OK" response
 func (r *Reply) IsOk() bool {
-	return r == okReply
+	return r == okReply || (r.Type() == ReplyStatus && string(r.stringValue) == "OK")
 }
 
 // IsString checks if reply is a string reply or not
@@ -335,26 +423,112 @@ func (r *Reply) IsError() bool {
 	return r.Type() == ReplyError
 }
 
+// IsMap checks if reply is a RESP3 map reply or not
+func (r *Reply) IsMap() bool {
+	return r.Type() == ReplyMap
+}
+
+// IsSet checks if reply is a RESP3 set reply or not
+func (r *Reply) IsSet() bool {
+	return r.Type() == ReplySet
+}
+
+// IsDouble checks if reply is a RESP3 double reply or not
+func (r *Reply) IsDouble() bool {
+	return r.Type() == ReplyDouble
+}
+
+// IsBool checks if reply is a RESP3 boolean reply or not
+func (r *Reply) IsBool() bool {
+	return r.Type() == ReplyBool
+}
+
+// IsBigNumber checks if reply is a RESP3 big number reply or not
+func (r *Reply) IsBigNumber() bool {
+	return r.Type() == ReplyBigNumber
+}
+
+// IsVerbatim checks if reply is a RESP3 verbatim string reply or not
+func (r *Reply) IsVerbatim() bool {
+	return r.Type() == ReplyVerbatim
+}
+
+// IsPush checks if reply is a RESP3 push reply or not
+func (r *Reply) IsPush() bool {
+	return r.Type() == ReplyPush
+}
+
+func (r *Reply) isAggregate() bool {
+	switch r.Type() {
+	case ReplyArray, ReplyMap, ReplySet, ReplyPush:
+		return true
+	default:
+		return false
+	}
+}
+
 // Receive safely read a reply from conn
 func Receive(conn *Conn) (r *Reply, err error) {
+	return ReceiveContext(context.Background(), conn)
+}
+
+// ReceiveContext safely read a reply from conn. The read is aborted
+// when ctx is cancelled, and the connection is then reconnected.
+func ReceiveContext(ctx context.Context, conn *Conn) (r *Reply, err error) {
+	return receive(ctx, conn, nil)
+}
+
+// receive reads a reply from conn. If cmd is not nil, the read timeout is the
+// one of the command the reply belongs to.
+func receive(ctx context.Context, conn *Conn, cmd *Command) (r *Reply, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	conn.Lock()
 	defer func() {
 		if err != nil {
 			conn.state = connStateNotConnected
 			conn.Unlock()
-			conn.fail()
+			conn.fail(err)
 		} else {
 			conn.Unlock()
 		}
 	}()
-	if conn.RequestTimeout != 0 {
-		conn.tcpConn.SetReadDeadline(time.Now().Add(conn.RequestTimeout))
+	stop := conn.watchContext(ctx)
+	defer stop()
+	timeout := conn.readTimeout()
+	if cmd != nil {
+		timeout = cmd.readTimeout(timeout)
+	}
+	conn.tcpConn.SetReadDeadline(deadline(ctx, timeout))
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err = readReply(conn)
+	if err != nil {
+		return nil, contextError(ctx, err)
 	}
-	return readReply(conn)
+	conn.trackUnsubscribe(r)
+	return r, nil
 }
 
-// Motivated by redigo. Good job, man
+// readReply reads the next reply from conn. RESP3 push frames are passed to
+// the connection push handler if there is one, and skipped.
 func readReply(conn *Conn) (*Reply, error) {
+	for {
+		rep, err := parseReply(conn)
+		if err != nil {
+			return nil, err
+		}
+		if rep.replyType != ReplyPush || conn.pushHandler == nil {
+			return rep, nil
+		}
+		conn.pushHandler(rep)
+	}
+}
+
+// Motivated by redigo. Good job, man
+func parseReply(conn *Conn) (*Reply, error) {
 	line, err := readLine(conn)
 	if err != nil {
 		return nil, err
@@ -375,14 +549,14 @@ func readReply(conn *Conn) (*Reply, error) {
 		default:
 			return &Reply{
 				replyType:   ReplyStatus,
-				stringValue: line[1:],
+				stringValue: append([]byte(nil), line[1:]...),
 			}, nil
 
 		}
 	case '-':
 		return &Reply{
 			replyType:   ReplyError,
-			stringValue: line[1:],
+			stringValue: append([]byte(nil), line[1:]...),
 		}, nil
 	case ':':
 		intValue, err := strconv.ParseInt(string(line[1:]), 10, 64)
@@ -394,52 +568,129 @@ func readReply(conn *Conn) (*Reply, error) {
 			integerValue: intValue,
 		}, nil
 	case '$':
-		l, err := strconv.ParseInt(string(line[1:]), 10, 64)
-		if err != nil {
+		return readBulk(conn, line, ReplyString)
+	case '!':
+		return readBulk(conn, line, ReplyError)
+	case '=':
+		rep, err := readBulk(conn, line, ReplyVerbatim)
+		if err == nil && rep.replyType == ReplyVerbatim && (len(rep.stringValue) < 4 || rep.stringValue[3] != ':') {
 			return nil, ErrRead
 		}
-		if l < 0 {
-			return &Reply{
-				replyType: ReplyNil,
-			}, nil
+		return rep, err
+	case '*':
+		return readAggregate(conn, line, ReplyArray)
+	case '~':
+		return readAggregate(conn, line, ReplySet)
+	case '>':
+		return readAggregate(conn, line, ReplyPush)
+	case '%':
+		return readAggregate(conn, line, ReplyMap)
+	case '_':
+		if len(line) != 1 {
+			return nil, ErrRead
 		}
-		b := make([]byte, l)
-		_, err = io.ReadFull(conn.rb, b)
-		if err != nil {
+		return &Reply{
+			replyType: ReplyNil,
+		}, nil
+	case '#':
+		if len(line) != 2 || (line[1] != 't' && line[1] != 'f') {
 			return nil, ErrRead
 		}
-		line, err = readLine(conn)
-		if err != nil || len(line) != 0 {
+		rep := &Reply{
+			replyType: ReplyBool,
+		}
+		if line[1] == 't' {
+			rep.integerValue = 1
+		}
+		return rep, nil
+	case ',':
+		doubleValue, err := strconv.ParseFloat(string(line[1:]), 64)
+		if err != nil {
 			return nil, ErrRead
 		}
 		return &Reply{
-			replyType:   ReplyString,
-			stringValue: b,
+			replyType:   ReplyDouble,
+			doubleValue: doubleValue,
+			stringValue: append([]byte(nil), line[1:]...),
 		}, nil
-	case '*':
-		l, err := strconv.ParseInt(string(line[1:]), 10, 64)
-		if err != nil {
+	case '(':
+		if _, ok := new(big.Int).SetString(string(line[1:]), 10); !ok {
 			return nil, ErrRead
 		}
-		if l < 0 {
-			return &Reply{
-				replyType: ReplyNil,
-			}, nil
+		return &Reply{
+			replyType:   ReplyBigNumber,
+			stringValue: append([]byte(nil), line[1:]...),
+		}, nil
+	case '|':
+		attributes, err := readAggregate(conn, line, ReplyMap)
+		if err != nil {
+			return nil, err
 		}
-		replyArray := make([]*Reply, l)
-		for i := range replyArray {
-			replyArray[i], err = readReply(conn)
-			if err != nil {
-				return nil, err
-			}
+		rep, err := parseReply(conn)
+		if err != nil {
+			return nil, err
 		}
+		// Shared replies such as okReply must not be modified
+		r := *rep
+		r.attributes = attributes
+		return &r, nil
+	default:
+		return nil, ErrRead
+	}
+}
+
+// readBulk reads a length-prefixed string. A negative length means nil.
+func readBulk(conn *Conn, line []byte, replyType int) (*Reply, error) {
+	l, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil {
+		return nil, ErrRead
+	}
+	if l < 0 {
 		return &Reply{
-			replyType:  ReplyArray,
-			arrayValue: replyArray,
+			replyType: ReplyNil,
 		}, nil
-	default:
+	}
+	b := make([]byte, l)
+	_, err = io.ReadFull(conn.rb, b)
+	if err != nil {
+		return nil, ErrRead
+	}
+	line, err = readLine(conn)
+	if err != nil || len(line) != 0 {
+		return nil, ErrRead
+	}
+	return &Reply{
+		replyType:   replyType,
+		stringValue: b,
+	}, nil
+}
+
+// readAggregate reads a length-prefixed list of replies. Maps are stored
+// as a flat list of keys and values. A negative length means nil.
+func readAggregate(conn *Conn, line []byte, replyType int) (*Reply, error) {
+	l, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil {
 		return nil, ErrRead
 	}
+	if l < 0 {
+		return &Reply{
+			replyType: ReplyNil,
+		}, nil
+	}
+	if replyType == ReplyMap {
+		l *= 2
+	}
+	replyArray := make([]*Reply, l)
+	for i := range replyArray {
+		replyArray[i], err = parseReply(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Reply{
+		replyType:  replyType,
+		arrayValue: replyArray,
+	}, nil
 }
 
 func readLine(conn *Conn) ([]byte, error) {
@@ -0,0 +1,128 @@
+package gore
+
+import (
+	"bufio"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func readTestReply(t *testing.T, raw string) *Reply {
+	conn := &Conn{rb: bufio.NewReader(strings.NewReader(raw))}
+	rep, err := readReply(conn)
+	if err != nil {
+		t.Fatal(raw, err)
+	}
+	return rep
+}
+
+func TestRESP3Reply(t *testing.T) {
+	rep := readTestReply(t, "%2\r\n+first\r\n$1\r\n1\r\n$6\r\nsecond\r\n,2.5\r\n")
+	m, err := rep.MapValue()
+	if err != nil || len(m) != 2 {
+		t.Fatal(err, m)
+	}
+	if x, err := m["first"].Int(); err != nil || x != 1 {
+		t.Fatal(err, x)
+	}
+	if x, err := m["second"].Double(); err != nil || x != 2.5 {
+		t.Fatal(err, x)
+	}
+	pairs := []*Pair{}
+	if err = rep.Slice(&pairs); err != nil || len(pairs) != 2 || string(pairs[0].First) != "first" {
+		t.Fatal(err, pairs)
+	}
+
+	rep = readTestReply(t, "~3\r\n:1\r\n:2\r\n:3\r\n")
+	ints := []int{}
+	if err = rep.Slice(&ints); err != nil || !rep.IsSet() || len(ints) != 3 || ints[2] != 3 {
+		t.Fatal(err, ints)
+	}
+
+	rep = readTestReply(t, ",-inf\r\n")
+	if x, err := rep.Float(); err != nil || !math.IsInf(x, -1) {
+		t.Fatal(err, x)
+	}
+	rep = readTestReply(t, "#t\r\n")
+	if x, err := rep.Bool(); err != nil || !x || !rep.IsBool() {
+		t.Fatal(err, x)
+	}
+	rep = readTestReply(t, "(3492890328409238509324850943850943825024385\r\n")
+	if x, err := rep.BigInt(); err != nil || x.String() != "3492890328409238509324850943850943825024385" {
+		t.Fatal(err, x)
+	}
+	if _, err = rep.Int(); err != ErrConvert {
+		t.Fatal(err)
+	}
+	rep = readTestReply(t, "=15\r\ntxt:Some string\r\n")
+	if s, err := rep.String(); err != nil || s != "Some string" {
+		t.Fatal(err, s)
+	}
+	if f, err := rep.Format(); err != nil || f != "txt" {
+		t.Fatal(err, f)
+	}
+	rep = readTestReply(t, "_\r\n")
+	if !rep.IsNil() {
+		t.Fatal("not nil", rep)
+	}
+	rep = readTestReply(t, "!21\r\nSYNTAX invalid syntax\r\n")
+	if e, err := rep.Error(); err != nil || e != "SYNTAX invalid syntax" {
+		t.Fatal(err, e)
+	}
+	rep = readTestReply(t, "|1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.19\r\n+OK\r\n")
+	if !rep.IsOk() || rep.Attributes() == nil || okReply.Attributes() != nil {
+		t.Fatal("bad attributes", rep)
+	}
+	if _, err = rep.Attributes().MapValue(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplyLargerThanBuffer(t *testing.T) {
+	// Simple replies must not point into the read buffer, which is reused
+	// while the rest of the aggregate is read
+	var b strings.Builder
+	b.WriteString("*4000\r\n")
+	for i := 0; i < 1000; i++ {
+		n := strconv.Itoa(i)
+		b.WriteString("," + n + ".5\r\n(" + n + "00000000000000000000\r\n+status" + n + "\r\n-ERR " + n + "\r\n")
+	}
+	rep := readTestReply(t, b.String())
+	replies, err := rep.Array()
+	if err != nil || len(replies) != 4000 {
+		t.Fatal(err, len(replies))
+	}
+	for i := 0; i < 1000; i++ {
+		n := strconv.Itoa(i)
+		if s, _ := replies[4*i].String(); s != n+".5" {
+			t.Fatal("double", i, s)
+		}
+		if s, _ := replies[4*i+1].String(); s != n+"00000000000000000000" {
+			t.Fatal("big number", i, s)
+		}
+		if s, _ := replies[4*i+2].String(); s != "status"+n {
+			t.Fatal("status", i, s)
+		}
+		if s, _ := replies[4*i+3].Error(); s != "ERR "+n {
+			t.Fatal("error", i, s)
+		}
+	}
+}
+
+func TestPushHandler(t *testing.T) {
+	pushes := []*Reply{}
+	conn := &Conn{
+		rb: bufio.NewReader(strings.NewReader(">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n+OK\r\n")),
+		pushHandler: func(rep *Reply) {
+			pushes = append(pushes, rep)
+		},
+	}
+	rep, err := readReply(conn)
+	if err != nil || !rep.IsOk() {
+		t.Fatal(err, rep)
+	}
+	if len(pushes) != 1 || !pushes[0].IsPush() {
+		t.Fatal(pushes)
+	}
+}
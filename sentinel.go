@@ -1,6 +1,7 @@
 package gore
 
 import (
+	"context"
 	"regexp"
 	"strings"
 	"sync"
@@ -17,6 +18,12 @@ type Sentinel struct {
 	mutex     *sync.Mutex
 	state     int
 	instances map[string]*instance
+	// Options used to open connections to monitored instances
+	Options *Options
+	// SentinelOptions are used to open connections to sentinel servers. If nil,
+	// the TLS, timeout and reconnection settings of Options are used, without
+	// its credentials, database, client name, protocol or Dialer.
+	SentinelOptions *Options
 }
 
 // NewSentinel returns new Sentinel
@@ -28,6 +35,13 @@ func NewSentinel() *Sentinel {
 	}
 }
 
+// NewSentinelWithOptions returns new Sentinel using options
+func NewSentinelWithOptions(options *Options) *Sentinel {
+	s := NewSentinel()
+	s.Options = options
+	return s
+}
+
 // AddServer adds new sentinel servers. Only one sentinel server is active
 // at any time. If this server fails, gore will connect to other sentinel
 // servers immediately.
@@ -69,15 +83,21 @@ func (s *Sentinel) Close() {
 // or the redis server is currently dead, or the redis server cannot be connected
 // (for example: firewall issues).
 func (s *Sentinel) GetPool(name string) (*Pool, error) {
-	return s.getPool(name, "")
+	return s.getPool(name, "", "")
 }
 
 // GetPoolWithPassword returns a pool of connection to a password-protected instance
 func (s *Sentinel) GetPoolWithPassword(name string, password string) (*Pool, error) {
-	return s.getPool(name, password)
+	return s.getPool(name, "", password)
+}
+
+// GetPoolWithCredentials returns a pool of connection to an instance protected
+// by a Redis 6 ACL user
+func (s *Sentinel) GetPoolWithCredentials(name string, username string, password string) (*Pool, error) {
+	return s.getPool(name, username, password)
 }
 
-func (s *Sentinel) getPool(name string, password string) (*Pool, error) {
+func (s *Sentinel) getPool(name string, username string, password string) (*Pool, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	if ins, ok := s.instances[name]; ok {
@@ -104,7 +124,7 @@ func (s *Sentinel) getPool(name string, password string) (*Pool, error) {
 		name:    name,
 		address: master["ip"] + ":" + master["port"],
 		state:   connStateConnected,
-		pool:    &Pool{sentinel: true, Password: password},
+		pool:    &Pool{sentinel: true, Username: username, Password: password, Options: s.Options},
 	}
 	err = ins.pool.Dial(ins.address)
 	if err != nil {
@@ -119,15 +139,21 @@ func (s *Sentinel) getPool(name string, password string) (*Pool, error) {
 // For example, if the cluster name is "mycluster", the instances' name
 // maybe "mycluster1", "mycluster2", ...
 func (s *Sentinel) GetCluster(name string) (c *Cluster, err error) {
-	return s.getCluster(name, "")
+	return s.getCluster(name, "", "")
 }
 
 // GetClusterWithPassword returns a password-protected cluster monitored by the sentinel.
 func (s *Sentinel) GetClusterWithPassword(name string, password string) (c *Cluster, err error) {
-	return s.getCluster(name, password)
+	return s.getCluster(name, "", password)
 }
 
-func (s *Sentinel) getCluster(name string, password string) (c *Cluster, err error) {
+// GetClusterWithCredentials returns a cluster monitored by the sentinel, protected
+// by a Redis 6 ACL user.
+func (s *Sentinel) GetClusterWithCredentials(name string, username string, password string) (c *Cluster, err error) {
+	return s.getCluster(name, username, password)
+}
+
+func (s *Sentinel) getCluster(name string, username string, password string) (c *Cluster, err error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	rep, err := NewCommand("SENTINEL", "masters").Run(s.conn)
@@ -162,7 +188,7 @@ func (s *Sentinel) getCluster(name string, password string) (c *Cluster, err err
 			name:    master["name"],
 			address: master["ip"] + ":" + master["port"],
 			state:   connStateConnected,
-			pool:    &Pool{sentinel: true, Password: password},
+			pool:    &Pool{sentinel: true, Username: username, Password: password, Options: s.Options},
 		}
 		err = ins.pool.Dial(ins.address)
 		if err != nil {
@@ -174,21 +200,31 @@ func (s *Sentinel) getCluster(name string, password string) (c *Cluster, err err
 	c.sentinel = true
 	for _, ins := range instances {
 		s.instances[ins.name] = ins
-		c.addresses = append(c.addresses, &addressWithPassword{ins.address, password})
+		c.addresses = append(c.addresses, &addressWithPassword{
+			address:  ins.address,
+			username: username,
+			password: password,
+			name:     ins.name,
+		})
 		c.shards = append(c.shards, ins.pool)
 	}
+	c.describeShards()
 	return c, nil
 }
 
 var suffixRegex = regexp.MustCompile("^\\d+$")
 
 func (s *Sentinel) connect() (err error) {
+	options := s.SentinelOptions
+	if options == nil {
+		options = s.Options.sentinelOptions()
+	}
 	for i, server := range s.servers {
-		s.conn, err = DialTimeout(server, time.Duration(Config.ConnectTimeout)*time.Second)
+		s.conn, err = dialContext(context.Background(), server, options.connectTimeout(), options)
 		if err != nil {
 			continue
 		}
-		s.subConn, err = DialTimeout(server, time.Duration(Config.ConnectTimeout)*time.Second)
+		s.subConn, err = dialContext(context.Background(), server, options.connectTimeout(), options)
 		if err != nil {
 			s.conn.Close()
 			continue
@@ -233,16 +269,22 @@ func (s *Sentinel) reconnect() {
 	s.subs.Close()
 	s.subConn.Close()
 	s.conn.Close()
-	sleepTime := Config.ReconnectTime
-	for {
+	s.Options.emit(&Event{Type: EventDisconnected, Address: s.conn.address, Err: ErrNotConnected})
+	policy := s.Options.reconnectPolicy()
+	for failures := 1; ; failures++ {
+		s.Options.emit(&Event{Type: EventReconnecting, Address: strings.Join(s.servers, ","), Attempt: failures})
 		err := s.connect()
 		if err == nil {
+			s.Options.emit(&Event{Type: EventReconnected, Address: s.conn.address, Attempt: failures})
 			break
 		}
-		time.Sleep(time.Duration(sleepTime) * time.Second)
-		if sleepTime < 30 {
-			sleepTime += 2
+		delay, ok := policy.Backoff(failures)
+		if !ok {
+			s.Options.emit(&Event{Type: EventGiveUp, Address: strings.Join(s.servers, ","), Attempt: failures, Err: err})
+			s.Options.giveUp(strings.Join(s.servers, ","), err)
+			break
 		}
+		time.Sleep(delay)
 	}
 }
 
@@ -258,14 +300,18 @@ func (s *Sentinel) monitor() {
 			s.mutex.Unlock()
 			continue
 		}
+		var event *Event
 		if message.Channel == "+sdown" || message.Channel == "+odown" {
-			ins.down(message)
+			event = ins.down(message)
 		} else if message.Channel == "-sdown" || message.Channel == "-odown" {
-			ins.up(message)
+			event = ins.up(message)
 		} else if message.Channel == "+switch-master" {
-			ins.switchMaster(s)
+			event = ins.switchMaster(s)
 		}
 		s.mutex.Unlock()
+		if event != nil {
+			s.Options.emit(event)
+		}
 	}
 }
 
@@ -291,7 +337,7 @@ func (s *Sentinel) getInstanceAddress(name string) string {
 	for {
 		rep, err := NewCommand("SENTINEL", "get-master-addr-by-name", name).Run(s.conn)
 		if err != nil {
-			time.Sleep(2 * time.Second)
+			time.Sleep(s.Options.retryInterval())
 			continue
 		}
 		if !rep.IsArray() {
@@ -315,9 +361,9 @@ type instance struct {
 	state   int
 }
 
-func (ins *instance) down(message *Message) {
+func (ins *instance) down(message *Message) *Event {
 	if ins.state != connStateConnected {
-		return
+		return nil
 	}
 	ins.state = connStateNotConnected
 	if message.Channel == "+sdown" {
@@ -326,11 +372,12 @@ func (ins *instance) down(message *Message) {
 		ins.odown = true
 	}
 	ins.pool.sentinelGonnaLetYouDown()
+	return &Event{Type: EventInstanceDown, Name: ins.name, Address: ins.pool.address}
 }
 
-func (ins *instance) up(message *Message) {
+func (ins *instance) up(message *Message) *Event {
 	if ins.state == connStateConnected {
-		return
+		return nil
 	}
 	if message.Channel == "-sdown" {
 		ins.sdown = false
@@ -340,14 +387,16 @@ func (ins *instance) up(message *Message) {
 	if !ins.sdown && !ins.odown {
 		ins.pool.sentinelGonnaGiveYouUp()
 		ins.state = connStateConnected
+		return &Event{Type: EventInstanceUp, Name: ins.name, Address: ins.pool.address}
 	}
+	return nil
 }
 
-func (ins *instance) switchMaster(s *Sentinel) {
+func (ins *instance) switchMaster(s *Sentinel) *Event {
 	address := s.getInstanceAddress(ins.name)
 	if address == "" {
 		// WTF
-		return
+		return nil
 	}
 	if ins.state == connStateConnected {
 		ins.pool.sentinelGonnaLetYouDown()
@@ -355,4 +404,5 @@ func (ins *instance) switchMaster(s *Sentinel) {
 	ins.pool.address = address
 	ins.pool.sentinelGonnaGiveYouUp()
 	ins.state = connStateConnected
+	return &Event{Type: EventFailover, Name: ins.name, Address: address}
 }
@@ -1,17 +1,64 @@
 package gore
 
+import (
+	"strings"
+	"sync"
+)
+
 // Cluster consists of fix number of shards, with each shard holds a portion
 // of the keyset. Cluster can be created by adding shards, or using sentinel.
 type Cluster struct {
-	addresses     []*addressWithPassword
-	shards        []*Pool
-	sentinel      bool
-	ShardStrategy func(string, int) int
+	addresses   []*addressWithPassword
+	shards      []*Pool
+	descriptors []*Shard
+	sentinel    bool
+	// ShardStrategy returns the index of the shard of a key, among size
+	// shards. DefaultShardStrategy is used by default.
+	ShardStrategy func(key string, size int) int
+	// ShardSelector, if set, is used instead of ShardStrategy to route commands
+	ShardSelector ShardSelector
+	// Options used to open connections to every shard
+	Options *Options
 }
 
 type addressWithPassword struct {
 	address  string
+	username string
 	password string
+	// name is the stable identity of the shard, the address or the
+	// sentinel instance name
+	name   string
+	weight int
+	tags   map[string]string
+}
+
+// Shard describes a shard of a cluster to a ShardSelector
+type Shard struct {
+	// Name is the stable identity of the shard: its address, or its
+	// instance name with sentinel
+	Name string
+	// Address is the address the shard was connected to. With sentinel, the
+	// shard may have failed over to another address since.
+	Address string
+	Weight  int
+	// Tags are set with AddShardWithTags, for example to mark the tenants
+	// served by the shard
+	Tags map[string]string
+}
+
+// ShardSelector routes the commands of a cluster. SelectShard returns the index in
+// shards of the shard which must run cmd, whose key is key. An index out of range makes
+// the command fail with ErrNoShard. shards must not be modified.
+type ShardSelector interface {
+	SelectShard(cmd *Command, key string, shards []*Shard) int
+}
+
+// ShardSelectorFunc is a function used as a ShardSelector
+type ShardSelectorFunc func(cmd *Command, key string, shards []*Shard) int
+
+// SelectShard calls f(cmd, key, shards)
+func (f ShardSelectorFunc) SelectShard(cmd *Command, key string, shards []*Shard) int {
+	return f(cmd, key, shards)
 }
 
 // NewCluster creates new cluster. You must add shards to this cluster manually
@@ -22,19 +69,83 @@ func NewCluster() *Cluster {
 	}
 }
 
+// NewClusterWithOptions creates new cluster using options to connect to every shard
+func NewClusterWithOptions(options *Options) *Cluster {
+	c := NewCluster()
+	c.Options = options
+	return c
+}
+
 // AddShard add a list of shards to the cluster.
 func (c *Cluster) AddShard(addresses ...string) {
 	if !c.sentinel {
 		for _, address := range addresses {
-			c.addresses = append(c.addresses, &addressWithPassword{address, ""})
+			c.addresses = append(c.addresses, &addressWithPassword{address: address, name: address})
 		}
 	}
 }
 
 // AddShardWithPassword add a password-protected shard
 func (c *Cluster) AddShardWithPassword(address, password string) {
+	c.AddShardWithCredentials(address, "", password)
+}
+
+// AddShardWithCredentials add a shard protected by a Redis 6 ACL user
+func (c *Cluster) AddShardWithCredentials(address, username, password string) {
 	if !c.sentinel {
-		c.addresses = append(c.addresses, &addressWithPassword{address, password})
+		c.addresses = append(c.addresses, &addressWithPassword{
+			address:  address,
+			username: username,
+			password: password,
+			name:     address,
+		})
+	}
+}
+
+// AddWeightedShard add a shard with a weight used by consistent hashing.
+// A shard of weight 2 holds about twice the keys of a shard of weight 1.
+func (c *Cluster) AddWeightedShard(address string, weight int) {
+	if !c.sentinel {
+		c.addresses = append(c.addresses, &addressWithPassword{address: address, name: address, weight: weight})
+	}
+}
+
+// AddShardWithTags add a shard with a weight and tags, which are given to the ShardSelector
+func (c *Cluster) AddShardWithTags(address string, weight int, tags map[string]string) {
+	if !c.sentinel {
+		c.addresses = append(c.addresses, &addressWithPassword{
+			address: address,
+			name:    address,
+			weight:  weight,
+			tags:    tags,
+		})
+	}
+}
+
+// UseConsistentHashing sets ShardStrategy to a consistent hash ring of the shards,
+// with virtualNodes points per shard, DefaultVirtualNodes if zero. Shards are identified
+// by their address, or their instance name with sentinel, so adding a shard only moves
+// about 1/n of the keys to it, and the order of the shards does not matter. The ring
+// is built when the first key is routed, and built again when shards are added later.
+func (c *Cluster) UseConsistentHashing(virtualNodes int) {
+	var mutex sync.Mutex
+	var ring *HashRing
+	size := 0
+	c.ShardStrategy = func(key string, _ int) int {
+		mutex.Lock()
+		if ring == nil || size != len(c.addresses) {
+			size = len(c.addresses)
+			names := make([]string, size)
+			weights := make([]int, size)
+			for i, address := range c.addresses {
+				names[i] = address.name
+				weights[i] = address.weight
+			}
+			ring = NewHashRing(names, weights, virtualNodes)
+		}
+		r := ring
+		mutex.Unlock()
+		return r.Get(key)
 	}
 }
 
@@ -55,25 +166,128 @@ func (c *Cluster) Dial() (err error) {
 		}
 	}()
 	for _, address := range c.addresses {
-		pool := &Pool{Password: address.password}
+		pool := &Pool{Username: address.username, Password: address.password, Options: c.Options}
 		err = pool.Dial(address.address)
 		if err != nil {
 			return err
 		}
 		c.shards = append(c.shards, pool)
 	}
+	c.describeShards()
 	return nil
 }
 
+// Shards returns the descriptors of the shards of a connected cluster, in the
+// order used by ShardStrategy and ShardSelector
+func (c *Cluster) Shards() []*Shard {
+	return c.descriptors
+}
+
+// describeShards builds the shard descriptors given to the ShardSelector
+func (c *Cluster) describeShards() {
+	c.descriptors = make([]*Shard, len(c.addresses))
+	for i, address := range c.addresses {
+		c.descriptors[i] = &Shard{
+			Name:    address.name,
+			Address: address.address,
+			Weight:  address.weight,
+			Tags:    address.tags,
+		}
+	}
+}
+
 // Execute runs a command on the cluster. The command will be send to appropriate shard
-// based on its key. If the command has no key (PING, INFO), this function returns
-// ErrNoKey
+// based on its keys. If the command has no key (PING, INFO), this function returns
+// ErrNoKey, and if its keys belong to different shards, ErrCrossShard
 func (c *Cluster) Execute(cmd *Command) (*Reply, error) {
-	if len(cmd.args) < 1 {
-		return nil, ErrNoKey
+	if step, ok := splitCommands[strings.ToUpper(cmd.name)]; ok && len(cmd.args) > step && len(cmd.args)%step == 0 {
+		return c.executeSplit(cmd, step)
+	}
+	pool, err := c.route(cmd)
+	if err != nil {
+		return nil, err
 	}
-	key := string(convertString(cmd.args[0]))
-	pool := c.shards[DefaultShardStrategy(key, len(c.shards))]
+	return runOnShard(pool, cmd)
+}
+
+// executeSplit runs a multi-key command on every shard holding some of its keys,
+// concurrently, and merges the replies in the order of the keys. step is the
+// number of arguments of each key.
+func (c *Cluster) executeSplit(cmd *Command, step int) (*Reply, error) {
+	if len(c.shards) == 0 {
+		return nil, ErrNoShard
+	}
+	// positions[shard] are the indexes of the keys of each shard
+	positions := make(map[int][]int)
+	order := []int{}
+	for i := 0; i+step <= len(cmd.args); i += step {
+		shard := c.shardOf(cmd, string(convertString(cmd.args[i])))
+		if shard < 0 || shard >= len(c.shards) {
+			return nil, ErrNoShard
+		}
+		if _, ok := positions[shard]; !ok {
+			order = append(order, shard)
+		}
+		positions[shard] = append(positions[shard], i/step)
+	}
+	if len(order) == 1 {
+		return runOnShard(c.shards[order[0]], cmd)
+	}
+	replies := make([]*Reply, len(order))
+	errs := make([]error, len(order))
+	var wg sync.WaitGroup
+	for i, shard := range order {
+		args := make([]interface{}, 0, len(positions[shard])*step)
+		for _, position := range positions[shard] {
+			args = append(args, cmd.args[position*step:position*step+step]...)
+		}
+		piece := NewCommand(cmd.name, args...)
+		piece.timeout = cmd.timeout
+		wg.Add(1)
+		go func(i int, pool *Pool) {
+			defer wg.Done()
+			replies[i], errs[i] = runOnShard(pool, piece)
+		}(i, c.shards[shard])
+	}
+	wg.Wait()
+	for i := range order {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if replies[i].IsError() {
+			return replies[i], nil
+		}
+	}
+	switch strings.ToUpper(cmd.name) {
+	case "MGET":
+		rep := &Reply{replyType: ReplyArray, arrayValue: make([]*Reply, len(cmd.args))}
+		for i, shard := range order {
+			values, err := replies[i].Array()
+			if err != nil || len(values) != len(positions[shard]) {
+				return nil, ErrType
+			}
+			for j, position := range positions[shard] {
+				rep.arrayValue[position] = values[j]
+			}
+		}
+		return rep, nil
+	case "MSET":
+		return replies[0], nil
+	default:
+		rep := &Reply{replyType: ReplyInteger}
+		for _, piece := range replies {
+			n, err := piece.Integer()
+			if err != nil {
+				return nil, err
+			}
+			rep.integerValue += n
+		}
+		return rep, nil
+	}
+}
+
+// runOnShard runs a command with a connection of the pool of a shard
+func runOnShard(pool *Pool, cmd *Command) (*Reply, error) {
 	conn, err := pool.Acquire()
 	if err != nil {
 		return nil, err
@@ -85,6 +299,51 @@ func (c *Cluster) Execute(cmd *Command) (*Reply, error) {
 	return cmd.Run(conn)
 }
 
+// splitCommands are the multi-key commands split across shards by Cluster, with
+// the number of arguments of each key
+var splitCommands = map[string]int{
+	"MGET":   1,
+	"MSET":   2,
+	"DEL":    1,
+	"UNLINK": 1,
+	"EXISTS": 1,
+	"TOUCH":  1,
+}
+
+// route returns the pool of the shard which must run cmd. Every key of cmd must
+// belong to the same shard.
+func (c *Cluster) route(cmd *Command) (*Pool, error) {
+	keys := cmd.Keys()
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	if len(c.shards) == 0 {
+		return nil, ErrNoShard
+	}
+	shard := c.shardOf(cmd, keys[0])
+	for _, key := range keys[1:] {
+		if c.shardOf(cmd, key) != shard {
+			return nil, ErrCrossShard
+		}
+	}
+	if shard < 0 || shard >= len(c.shards) {
+		return nil, ErrNoShard
+	}
+	return c.shards[shard], nil
+}
+
+// shardOf returns the index of the shard of a key of cmd, chosen by the
+// ShardSelector, or the ShardStrategy if there is no selector.
+func (c *Cluster) shardOf(cmd *Command, key string) int {
+	if c.ShardSelector != nil {
+		return c.ShardSelector.SelectShard(cmd, key, c.descriptors)
+	}
+	if c.ShardStrategy != nil {
+		return c.ShardStrategy(key, len(c.shards))
+	}
+	return DefaultShardStrategy(key, len(c.shards))
+}
+
 // DefaultShardStrategy converts a string key into number and takes modulo
 // with the size of cluster
 func DefaultShardStrategy(key string, size int) int {
@@ -2,6 +2,9 @@ package gore
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -39,3 +42,218 @@ func TestSharding(t *testing.T) {
 		}
 	}
 }
+
+func TestClusterShardStrategy(t *testing.T) {
+	keys := [2]chan string{make(chan string, 100), make(chan string, 100)}
+	servers := [2]*fakeServer{}
+	for i := range servers {
+		i := i
+		servers[i] = newFakeServer(t, func(args []string) string {
+			keys[i] <- args[1]
+			return "+OK\r\n"
+		})
+		defer servers[i].Close()
+	}
+
+	c := NewCluster()
+	c.AddShard(servers[0].Addr(), servers[1].Addr())
+	c.ShardStrategy = func(key string, size int) int {
+		return 1
+	}
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	c.Execute(NewCommand("SET", "kirisame", "marisa"))
+	if key := <-keys[1]; key != "kirisame" {
+		t.Fatal("shard strategy was not used", key)
+	}
+
+	c.UseConsistentHashing(0)
+	ring := NewHashRing([]string{servers[0].Addr(), servers[1].Addr()}, nil, 0)
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		c.Execute(NewCommand("SET", key, i))
+		if got := <-keys[ring.Get(key)]; got != key {
+			t.Fatal(key, got)
+		}
+	}
+
+	// Shards added after UseConsistentHashing are on the ring too
+	c = NewCluster()
+	c.UseConsistentHashing(0)
+	c.AddShard(servers[0].Addr())
+	c.AddShard(servers[1].Addr())
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		c.Execute(NewCommand("SET", key, i))
+		if got := <-keys[ring.Get(key)]; got != key {
+			t.Fatal(key, got)
+		}
+	}
+}
+
+func TestClusterShardSelector(t *testing.T) {
+	keys := [2]chan string{make(chan string, 100), make(chan string, 100)}
+	servers := [2]*fakeServer{}
+	for i := range servers {
+		i := i
+		servers[i] = newFakeServer(t, func(args []string) string {
+			keys[i] <- args[1]
+			return "+OK\r\n"
+		})
+		defer servers[i].Close()
+	}
+
+	c := NewCluster()
+	c.AddShardWithTags(servers[0].Addr(), 1, map[string]string{"tenant": "hakurei"})
+	c.AddShardWithTags(servers[1].Addr(), 1, map[string]string{"tenant": "kirisame"})
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	shards := c.Shards()
+	if len(shards) != 2 || shards[1].Address != servers[1].Addr() || shards[1].Name != servers[1].Addr() ||
+		shards[1].Weight != 1 || shards[1].Tags["tenant"] != "kirisame" {
+		t.Fatal("bad shard descriptors", shards)
+	}
+
+	var commands []string
+	c.ShardSelector = ShardSelectorFunc(func(cmd *Command, key string, shards []*Shard) int {
+		commands = append(commands, cmd.name)
+		tenant := strings.SplitN(key, ":", 2)[0]
+		for i, shard := range shards {
+			if shard.Tags["tenant"] == tenant {
+				return i
+			}
+		}
+		return -1
+	})
+	// ShardSelector has precedence over ShardStrategy
+	c.ShardStrategy = func(key string, size int) int {
+		return 0
+	}
+	for _, key := range []string{"kirisame:marisa", "hakurei:reimu", "kirisame:spark"} {
+		rep, err := c.Execute(NewCommand("SET", key, "touhou"))
+		if err != nil || !rep.IsOk() {
+			t.Fatal(err, rep)
+		}
+	}
+	if <-keys[1] != "kirisame:marisa" || <-keys[0] != "hakurei:reimu" || <-keys[1] != "kirisame:spark" {
+		t.Fatal("commands were not routed by tenant")
+	}
+	if len(commands) != 3 || commands[0] != "SET" {
+		t.Fatal("selector did not receive the commands", commands)
+	}
+	if _, err := c.Execute(NewCommand("SET", "izayoi:sakuya", "touhou")); err != ErrNoShard {
+		t.Fatal("expected ErrNoShard", err)
+	}
+}
+
+// newFakeShard returns a fake server storing strings, for GET, MGET, SET, MSET, DEL and EXISTS
+func newFakeShard(t *testing.T, commands chan []string) *fakeServer {
+	var mutex sync.Mutex
+	values := make(map[string]string)
+	return newFakeServer(t, func(args []string) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		commands <- args
+		switch args[0] {
+		case "MSET":
+			for i := 1; i+1 < len(args); i += 2 {
+				values[args[i]] = args[i+1]
+			}
+			return "+OK\r\n"
+		case "MGET":
+			rep := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+			for _, key := range args[1:] {
+				if value, ok := values[key]; ok {
+					rep += "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+				} else {
+					rep += "$-1\r\n"
+				}
+			}
+			return rep
+		case "DEL", "EXISTS":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := values[key]; ok {
+					n++
+					if args[0] == "DEL" {
+						delete(values, key)
+					}
+				}
+			}
+			return ":" + strconv.Itoa(n) + "\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+}
+
+func TestClusterSplit(t *testing.T) {
+	commands := [2]chan []string{make(chan []string, 100), make(chan []string, 100)}
+	servers := [2]*fakeServer{}
+	for i := range servers {
+		servers[i] = newFakeShard(t, commands[i])
+		defer servers[i].Close()
+	}
+	c := NewCluster()
+	c.AddShard(servers[0].Addr(), servers[1].Addr())
+	c.ShardStrategy = func(key string, size int) int {
+		if key[0] == 'a' {
+			return 0
+		}
+		return 1
+	}
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := c.Execute(NewCommand("MSET", "a1", "x", "b1", "y", "a2", "z"))
+	if err != nil || !rep.IsOk() {
+		t.Fatal(err, rep)
+	}
+	if args := <-commands[0]; strings.Join(args, " ") != "MSET a1 x a2 z" {
+		t.Fatal(args)
+	}
+	if args := <-commands[1]; strings.Join(args, " ") != "MSET b1 y" {
+		t.Fatal(args)
+	}
+
+	rep, err = c.Execute(NewCommand("MGET", "b1", "a1", "b2", "a2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []string{}
+	if err = rep.Slice(&values); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(values, " ") != "y x  z" {
+		t.Fatal(values)
+	}
+	replies, _ := rep.Array()
+	if !replies[2].IsNil() {
+		t.Fatal("missing key should be nil", replies[2])
+	}
+
+	rep, err = c.Execute(NewCommand("EXISTS", "a1", "b1", "b2"))
+	if n, _ := rep.Int(); err != nil || n != 2 {
+		t.Fatal(err, n)
+	}
+	rep, err = c.Execute(NewCommand("DEL", "a1", "b1", "a2"))
+	if n, _ := rep.Int(); err != nil || n != 3 {
+		t.Fatal(err, n)
+	}
+
+	// Keys of a single shard are sent as is
+	for len(commands[1]) > 0 {
+		<-commands[1]
+	}
+	if _, err = c.Execute(NewCommand("MGET", "b1", "b2")); err != nil {
+		t.Fatal(err)
+	}
+	if args := <-commands[1]; strings.Join(args, " ") != "MGET b1 b2" {
+		t.Fatal(args)
+	}
+}
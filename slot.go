@@ -0,0 +1,48 @@
+package gore
+
+import (
+	"strings"
+)
+
+// SlotCount is the number of hash slots of a Redis Cluster
+const SlotCount = 16384
+
+var crc16Table = makeCRC16Table()
+
+// makeCRC16Table returns the lookup table of CRC16-CCITT (XMODEM), the checksum
+// used by Redis Cluster to compute hash slots
+func makeCRC16Table() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// Slot returns the Redis Cluster hash slot of a key. If the key contains a
+// non-empty hash tag between { and }, only the hash tag is hashed, so that
+// keys like "{user1000}.following" and "{user1000}.followers" have the same slot.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % SlotCount
+}
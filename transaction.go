@@ -1,6 +1,7 @@
 package gore
 
 import (
+	"context"
 	"time"
 )
 
@@ -43,34 +44,55 @@ func (t *Transaction) Add(cmd ...*Command) {
 // If transaction fail, ErrTransactionAborted is returned.
 // If watched key has been modified, ErrKeyChanged is returned.
 func (t *Transaction) Commit() ([]*Reply, error) {
+	return t.CommitContext(context.Background())
+}
+
+// CommitContext commits the whole transaction like Commit. The commit is
+// aborted when ctx is cancelled, and the connection is then reconnected,
+// so that the server discards the unfinished transaction.
+func (t *Transaction) CommitContext(ctx context.Context) ([]*Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if t.conn.state != connStateConnected {
 		return nil, ErrNotConnected
 	}
+	// The connection is failed once unlocked, like a failed pipeline
+	var failure error
+	t.conn.Lock()
+	defer func() {
+		t.conn.Unlock()
+		if failure != nil {
+			t.conn.fail(failure)
+		}
+	}()
+	stop := t.conn.watchContext(ctx)
+	defer stop()
 	t.commands = append(t.commands, NewCommand("EXEC"))
-	if t.conn.RequestTimeout != 0 {
-		t.conn.tcpConn.SetWriteDeadline(time.Now().Add(t.conn.RequestTimeout * time.Duration(len(t.commands)/10+1)))
-	}
+	t.conn.tcpConn.SetWriteDeadline(deadline(ctx, t.conn.writeTimeout()*time.Duration(len(t.commands)/10+1)))
 	for _, cmd := range t.commands {
 		err := cmd.writeCommand(t.conn)
 		if err != nil {
-			t.conn.fail()
-			return nil, ErrWrite
+			failure = err
+			return nil, contextError(ctx, ErrWrite)
 		}
 	}
 	err := t.conn.wb.Flush()
 	if err != nil {
-		t.conn.fail()
-		return nil, ErrWrite
+		failure = err
+		return nil, contextError(ctx, ErrWrite)
 	}
-	if t.conn.RequestTimeout != 0 {
-		t.conn.tcpConn.SetReadDeadline(time.Now().Add(t.conn.RequestTimeout * time.Duration(len(t.commands)/10+1)))
+	t.conn.tcpConn.SetReadDeadline(deadline(ctx, readTimeout(t.conn, t.commands)))
+	if err := ctx.Err(); err != nil {
+		failure = err
+		return nil, err
 	}
 	replies := make([]*Reply, len(t.commands))
 	for i := range replies {
 		rep, err := readReply(t.conn)
 		if err != nil {
-			t.conn.fail()
-			return nil, err
+			failure = err
+			return nil, contextError(ctx, err)
 		}
 		replies[i] = rep
 	}
@@ -82,7 +104,7 @@ func (t *Transaction) Commit() ([]*Reply, error) {
 		return replies, ErrKeyChanged
 	}
 	if !execReply.IsArray() {
-		t.conn.fail()
+		failure = ErrType
 		return replies, ErrType
 	}
 	return execReply.Array()
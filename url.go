@@ -0,0 +1,197 @@
+package gore
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URL holds connection settings parsed from a redis URL
+type URL struct {
+	// Addresses of redis servers, or sentinel servers for a redis-sentinel URL
+	Addresses []string
+	// MasterName is the monitored instance name of a redis-sentinel URL
+	MasterName string
+	// Options used to open connections to redis servers
+	Options *Options
+}
+
+// ParseURL parses a redis URL. The following schemes are supported:
+//
+//	redis://[[username]:password@]host[:port][,host[:port]...][/database][?parameters]
+//	rediss://[[username]:password@]host[:port][,host[:port]...][/database][?parameters]
+//	unix://[[username]:password@]/path/to/socket[?parameters]
+//	redis-sentinel://[[username]:password@]host[:port][,host[:port]...]/master[/database][?parameters]
+//
+// rediss enables TLS. For redis-sentinel, the credentials and database are used
+// for the monitored instance, not for the sentinel servers.
+// Supported parameters are db, client_name, protocol, dial_timeout, request_timeout,
+// read_timeout, write_timeout, pool_size and pool_initial_size. Timeouts are written like "3s" or "500ms".
+func ParseURL(rawurl string) (*URL, error) {
+	rawurl, hosts := cutHosts(rawurl)
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	result := &URL{Options: &Options{}}
+	if u.User != nil {
+		result.Options.Username = u.User.Username()
+		result.Options.Password, _ = u.User.Password()
+	}
+	path := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "redis", "rediss":
+		result.Addresses = splitHosts(hosts, "6379")
+		if path != "" {
+			if result.Options.Database, err = strconv.Atoi(path); err != nil {
+				return nil, ErrInvalidURL
+			}
+		}
+		if u.Scheme == "rediss" {
+			result.Options.TLSConfig = &tls.Config{}
+		}
+	case "unix":
+		if hosts != "" || u.Path == "" {
+			return nil, ErrInvalidURL
+		}
+		result.Addresses = []string{u.Path}
+		result.Options.Network = "unix"
+	case "redis-sentinel":
+		result.Addresses = splitHosts(hosts, "26379")
+		pieces := strings.Split(path, "/")
+		if pieces[0] == "" || len(pieces) > 2 {
+			return nil, ErrInvalidURL
+		}
+		result.MasterName = pieces[0]
+		if len(pieces) == 2 {
+			if result.Options.Database, err = strconv.Atoi(pieces[1]); err != nil {
+				return nil, ErrInvalidURL
+			}
+		}
+	default:
+		return nil, ErrInvalidURL
+	}
+	for key, values := range u.Query() {
+		if len(values) != 1 {
+			return nil, ErrInvalidURL
+		}
+		if err = result.Options.setParameter(key, values[0]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// DialURL opens a connection with the redis server of a URL
+func DialURL(rawurl string) (*Conn, error) {
+	u, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return u.Dial()
+}
+
+// Dial opens a connection with the first redis server of the URL
+func (u *URL) Dial() (*Conn, error) {
+	if u.MasterName != "" {
+		return nil, ErrInvalidURL
+	}
+	return DialWithOptions(u.Addresses[0], u.Options)
+}
+
+// DialPool opens a pool of connection to the first redis server of the URL
+func (u *URL) DialPool() (*Pool, error) {
+	if u.MasterName != "" {
+		return nil, ErrInvalidURL
+	}
+	pool := NewPool(u.Options)
+	if err := pool.Dial(u.Addresses[0]); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// NewCluster returns a cluster with every redis server of the URL as a shard.
+// The cluster is not dialed yet.
+func (u *URL) NewCluster() *Cluster {
+	c := NewClusterWithOptions(u.Options)
+	c.AddShard(u.Addresses...)
+	return c
+}
+
+// NewSentinel returns a sentinel with every sentinel server of the URL.
+// The sentinel is not dialed yet. The monitored instance can be retrieved
+// with GetPool(u.MasterName).
+func (u *URL) NewSentinel() *Sentinel {
+	s := NewSentinelWithOptions(u.Options)
+	s.AddServer(u.Addresses...)
+	return s
+}
+
+func (o *Options) setParameter(key, value string) (err error) {
+	switch key {
+	case "db":
+		o.Database, err = strconv.Atoi(value)
+	case "client_name":
+		o.ClientName = value
+	case "protocol":
+		o.Protocol, err = strconv.Atoi(value)
+	case "dial_timeout":
+		o.ConnectTimeout, err = time.ParseDuration(value)
+	case "request_timeout":
+		o.RequestTimeout, err = time.ParseDuration(value)
+	case "read_timeout":
+		o.ReadTimeout, err = time.ParseDuration(value)
+	case "write_timeout":
+		o.WriteTimeout, err = time.ParseDuration(value)
+	case "pool_size":
+		o.PoolMaximumSize, err = strconv.Atoi(value)
+	case "pool_initial_size":
+		o.PoolInitialSize, err = strconv.Atoi(value)
+	default:
+		return ErrInvalidURL
+	}
+	if err != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// cutHosts removes the host list from rawurl, because net/url does not
+// accept several hosts in one URL.
+func cutHosts(rawurl string) (string, string) {
+	i := strings.Index(rawurl, "://")
+	if i < 0 {
+		return rawurl, ""
+	}
+	start := i + 3
+	end := strings.IndexAny(rawurl[start:], "/?#")
+	if end < 0 {
+		end = len(rawurl)
+	} else {
+		end += start
+	}
+	if at := strings.LastIndex(rawurl[start:end], "@"); at >= 0 {
+		start += at + 1
+	}
+	return rawurl[:start] + rawurl[end:], rawurl[start:end]
+}
+
+func splitHosts(hosts, defaultPort string) []string {
+	addresses := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			addresses = append(addresses, host)
+			continue
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			host = "localhost"
+		}
+		addresses = append(addresses, net.JoinHostPort(host, defaultPort))
+	}
+	return addresses
+}